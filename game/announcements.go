@@ -0,0 +1,52 @@
+package game
+
+import (
+	"fmt"
+	"time"
+)
+
+/*********************************************************
+ *														 *
+ *                   	  Warships						 *
+ *					   Jason Meredith					 *
+ *														 *
+ *	DATE:		October 18, 2026						 *
+ *	FILE: 		announcements.go						 *
+ *	PURPOSE:	Server-wide announcements. Anything		 *
+ *				every Player should hear about is kept	 *
+ *				here until each Player has seen it.		 *
+ *				 										 *
+ *														 *
+ *********************************************************/
+
+// Announcement is a message sent to every Player on the Server
+type Announcement struct {
+	Time	time.Time
+	Message	string
+}
+
+// Announce adds a new Announcement for every Player to see
+func (game *Game) Announce(format string, a ...interface{}) {
+	game.Announcements = append(game.Announcements, Announcement{
+		Time:    time.Now(),
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+// UnseenAnnouncements returns every Announcement made since the Player last checked
+// and marks them as seen. Spectators only get Announcements older than the spectator delay
+func (game *Game) UnseenAnnouncements(player *Player) []Announcement {
+
+	end := len(game.Announcements)
+	if player.Spectator {
+		cutoff := game.SpectatorCutoff()
+		for end > player.AnnouncementsSeen && game.Announcements[end-1].Time.After(cutoff) {
+			end--
+		}
+	}
+
+	unseen := game.Announcements[player.AnnouncementsSeen:end]
+	player.AnnouncementsSeen = end
+
+	return unseen
+}
@@ -0,0 +1,148 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+/*********************************************************
+ *														 *
+ *                   	  Warships						 *
+ *					   Jason Meredith					 *
+ *														 *
+ *	DATE:		October 18, 2026						 *
+ *	FILE: 		bans.go									 *
+ *	PURPOSE:	The ban list. Bans match Players by		 *
+ *				username or by remote address, and the	 *
+ *				list is saved to a file so bans last	 *
+ *				between server restarts.				 *
+ *				 										 *
+ *														 *
+ *********************************************************/
+
+// DEFAULT_BAN_FILE is where the ban list is saved unless the server says otherwise
+const DEFAULT_BAN_FILE = "warships-bans.json"
+
+// Ban keeps a Player out of the Game by username and by the address they connected from
+type Ban struct {
+	Username	string
+	Address		string
+
+	// When the Ban runs out, a zero time means it never does
+	Expires		time.Time
+}
+
+// BanList is every Ban on the Server along with the file it is saved to
+type BanList struct {
+	Path	string
+	Bans	[]*Ban
+}
+
+// Active returns true if the Ban hasn't run out yet
+func (ban *Ban) Active() bool {
+	return ban.Expires.IsZero() || time.Now().Before(ban.Expires)
+}
+
+// Error describes the Ban to the Player it's keeping out
+func (ban *Ban) Error() string {
+	if ban.Expires.IsZero() {
+		return "you have been banned from this server"
+	}
+
+	return fmt.Sprintf("you have been banned from this server for another %v",
+		time.Until(ban.Expires).Round(time.Second))
+}
+
+// LoadBanList reads a BanList from a file. If the file doesn't exist yet an empty
+// BanList is returned that will be saved there
+func LoadBanList(path string) (*BanList, error) {
+
+	list := &BanList{Path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return list, nil
+	}
+	if err != nil {
+		return list, err
+	}
+
+	if err := json.Unmarshal(data, &list.Bans); err != nil {
+		return list, errors.New("ban list file is corrupt: " + path)
+	}
+
+	return list, nil
+}
+
+// Save writes the BanList to its file, dropping any Bans that have run out
+func (list *BanList) Save() error {
+
+	if list.Path == "" {
+		return nil
+	}
+
+	var active []*Ban
+	for _, ban := range list.Bans {
+		if ban.Active() {
+			active = append(active, ban)
+		}
+	}
+	list.Bans = active
+
+	data, err := json.MarshalIndent(list.Bans, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(list.Path, data, 0600)
+}
+
+// Add adds a Ban and saves the BanList
+func (list *BanList) Add(ban *Ban) error {
+	list.Bans = append(list.Bans, ban)
+	return list.Save()
+}
+
+// Remove lifts every Ban on a username and saves the BanList. Returns false if
+// the username wasn't banned
+func (list *BanList) Remove(username string) (bool, error) {
+
+	var remaining []*Ban
+	for _, ban := range list.Bans {
+		if ban.Username != username {
+			remaining = append(remaining, ban)
+		}
+	}
+
+	if len(remaining) == len(list.Bans) {
+		return false, nil
+	}
+
+	list.Bans = remaining
+
+	return true, list.Save()
+}
+
+// Check returns the active Ban matching a username or address, or nil if there isn't one
+func (list *BanList) Check(username, address string) *Ban {
+
+	if list == nil {
+		return nil
+	}
+
+	for _, ban := range list.Bans {
+		if !ban.Active() {
+			continue
+		}
+
+		if ban.Username == username || (address != "" && ban.Address == address) {
+			return ban
+		}
+	}
+
+	return nil
+}
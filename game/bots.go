@@ -0,0 +1,364 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+/*********************************************************
+ *														 *
+ *                   	  Warships						 *
+ *					   Jason Meredith					 *
+ *														 *
+ *	DATE:		October 18, 2026						 *
+ *	FILE: 		bots.go									 *
+ *	PURPOSE:	Server-managed bot Players that fill	 *
+ *				out Teams when few humans are online.	 *
+ *				Bots deploy Ships with their Team's		 *
+ *				points and fire hunt-then-target, and	 *
+ *				step aside when a human takes their		 *
+ *				place.									 *
+ *				 										 *
+ *														 *
+ *********************************************************/
+
+// Difficulty is integer used to represent the Difficulty enum options. Represents how
+// well a Bot plays
+type Difficulty uint8
+
+// Difficulty levels a Bot can be set to
+const (
+	EASY Difficulty = iota
+	MEDIUM
+	HARD
+)
+
+var difficultyNames = []string{"easy", "medium", "hard"}
+
+// String returns the name of the Difficulty
+func (difficulty Difficulty) String() string {
+	if int(difficulty) < len(difficultyNames) {
+		return difficultyNames[difficulty]
+	}
+	return "unknown"
+}
+
+// ParseDifficulty converts the name of a Difficulty (easy, medium or hard) to a Difficulty
+func ParseDifficulty(name string) (Difficulty, error) {
+	for i, difficultyName := range difficultyNames {
+		if strings.ToLower(name) == difficultyName {
+			return Difficulty(i), nil
+		}
+	}
+
+	return EASY, errors.New("difficulty invalid, use easy, medium or hard")
+}
+
+// botSkill is how a Difficulty plays
+type botSkill struct {
+
+	// Chance of firing a shot each time the Bot gets a turn
+	fireChance float64
+
+	// Chance of following up on the Team's hits rather than hunting for new Ships
+	followChance float64
+
+	// Hunt on a checkerboard pattern, any Ship longer than one square has to cross it
+	parity bool
+
+	// Follow along lines of hits rather than trying every square around a hit
+	lines bool
+}
+
+var botSkills = []botSkill{
+	EASY:   {fireChance: 0.5, followChance: 0.3},
+	MEDIUM: {fireChance: 0.75, followChance: 1},
+	HARD:   {fireChance: 1, followChance: 1, parity: true, lines: true},
+}
+
+// BOT_ATTEMPTS is how many random spots a Bot tries when placing a Ship
+const BOT_ATTEMPTS = 20
+
+// Bot is the brain behind a server-managed Player
+type Bot struct {
+	Difficulty Difficulty
+
+	random *rand.Rand
+}
+
+// AddBot creates a bot Player and puts it on team, or on the smallest Team if team is nil.
+// Bots take up one of the Game's MaxPlayers spots until a human needs it
+func (game *Game) AddBot(difficulty Difficulty, team *Team) (*Player, error) {
+
+	if game.MaxPlayers != 0 && game.NumPlayers() >= int(game.MaxPlayers) {
+		return nil, ErrGameFull
+	}
+
+	if team == nil {
+		team = game.GetSmallestTeam()
+		if team == nil {
+			return nil, ErrNoOpenTeam
+		}
+	}
+
+	id, err := NewPlayerId()
+	if err != nil {
+		return nil, err
+	}
+
+	// Pick the first free bot name
+	username := ""
+	for n := 1; username == ""; n++ {
+		name := fmt.Sprintf("Bot-%v", n)
+		if game.GetPlayerByUsername(name) == nil && game.GetSpectator(name) == nil {
+			username = name
+		}
+	}
+
+	// Bots have no password hash, so nobody can log in as one
+	bot := Player{
+		Username: username,
+		Team:     team,
+		Id:       id,
+		Bot: &Bot{
+			Difficulty: difficulty,
+			random:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		},
+	}
+
+	team.Players = append(team.Players, &bot)
+	team.NumPlayers++
+
+	return &bot, nil
+}
+
+// Bots returns every bot Player in the Game
+func (game *Game) Bots() []*Player {
+	var bots []*Player
+	for _, team := range game.Teams {
+		for _, player := range team.Players {
+			if player.Bot != nil {
+				bots = append(bots, player)
+			}
+		}
+	}
+
+	return bots
+}
+
+// stepAside makes room for a human who just joined team. Bots only leave if the Game is
+// now over MaxPlayers, or if the human left team bigger than every other Team. A bot on
+// team goes first, otherwise one from any Team. Returns the bot that left
+func (game *Game) stepAside(team *Team) *Player {
+
+	full := game.MaxPlayers != 0 && game.NumPlayers() > int(game.MaxPlayers)
+	if !full && !game.largest(team) {
+		return nil
+	}
+
+	for i := len(team.Players) - 1; i >= 0; i-- {
+		if team.Players[i].Bot != nil {
+			bot := team.Players[i]
+			game.RemovePlayer(bot)
+			return bot
+		}
+	}
+
+	if full {
+		if bots := game.Bots(); len(bots) > 0 {
+			game.RemovePlayer(bots[0])
+			return bots[0]
+		}
+	}
+
+	return nil
+}
+
+// largest returns true if team has more Players, bots included, than every other Team
+func (game *Game) largest(team *Team) bool {
+	for _, other := range game.Teams {
+		if other != team && other.NumPlayers >= team.NumPlayers {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RunBots gives every bot Player a turn
+func (game *Game) RunBots() {
+	for _, player := range game.Bots() {
+		player.Bot.takeTurn(player)
+	}
+}
+
+// takeTurn has the Bot spend its Team's deployment points and maybe fire a shot
+func (bot *Bot) takeTurn(player *Player) {
+
+	skill := botSkills[bot.Difficulty]
+
+	bot.deploy(player.Team)
+
+	// You must have ships to target another team
+	if len(player.Team.Ships) == 0 || bot.random.Float64() >= skill.fireChance {
+		return
+	}
+
+	targetTeam, coordinate, ok := bot.aim(player.Team, skill)
+	if !ok {
+		return
+	}
+
+	FireShot(player, targetTeam, coordinate.ToTarget())
+}
+
+// deploy places a Ship between two and five squares long if the Team can afford one
+func (bot *Bot) deploy(team *Team) {
+
+	size := uint8(2 + bot.random.Intn(4))
+	if size > team.Game.BoardSize || team.DeploymentPoints < int(size) {
+		return
+	}
+
+	for attempt := 0; attempt < BOT_ATTEMPTS; attempt++ {
+		orientation := Orientation(bot.random.Intn(2))
+		coordinate := Coordinate{
+			X: uint8(bot.random.Intn(int(team.Game.BoardSize))),
+			Y: uint8(bot.random.Intn(int(team.Game.BoardSize))),
+		}
+
+		if _, err := team.Deploy(size, orientation, coordinate); err == nil {
+			return
+		}
+	}
+}
+
+// aim picks the Team and square to fire upon. Enemy Teams with hits still to follow up
+// are targeted first, otherwise the Bot hunts a random enemy Team for new Ships
+func (bot *Bot) aim(team *Team, skill botSkill) (*Team, Coordinate, bool) {
+
+	game := team.Game
+
+	var enemies []*Team
+	for _, other := range game.Teams {
+		if other != team && !game.Allied(team, other) {
+			enemies = append(enemies, other)
+		}
+	}
+
+	if len(enemies) == 0 {
+		return nil, Coordinate{}, false
+	}
+
+	if bot.random.Float64() < skill.followChance {
+		for _, i := range bot.random.Perm(len(enemies)) {
+			candidates := bot.followUp(team, enemies[i], skill.lines)
+			if len(candidates) > 0 {
+				return enemies[i], candidates[bot.random.Intn(len(candidates))], true
+			}
+		}
+	}
+
+	for _, i := range bot.random.Perm(len(enemies)) {
+		candidates := bot.hunt(team, enemies[i], skill.parity)
+		if len(candidates) > 0 {
+			return enemies[i], candidates[bot.random.Intn(len(candidates))], true
+		}
+	}
+
+	return nil, Coordinate{}, false
+}
+
+// followUp returns the untried squares next to the Team's hits on targetTeam. When lines
+// is set and hits line up, only the squares at the ends of those lines are returned. Hits
+// on Ships that have been sunk are left out, there is nothing more to find around them
+func (bot *Bot) followUp(team *Team, targetTeam *Team, lines bool) []Coordinate {
+
+	tried := triedSquares(team, targetTeam)
+	hits := make(map[Coordinate]bool)
+	for _, hit := range team.Hits[targetTeam] {
+		if ship := CheckLocation(targetTeam, hit); ship != nil && ship.Health == 0 {
+			continue
+		}
+		hits[hit] = true
+	}
+
+	size := int(team.Game.BoardSize)
+	directions := [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+
+	// square returns the Coordinate at x, y if it is on the board and hasn't been tried
+	square := func(x, y int) (Coordinate, bool) {
+		if x < 0 || y < 0 || x >= size || y >= size {
+			return Coordinate{}, false
+		}
+		coordinate := Coordinate{uint8(x), uint8(y)}
+		return coordinate, !tried[coordinate]
+	}
+
+	var neighbours, lineEnds []Coordinate
+	for hit := range hits {
+		for _, direction := range directions {
+			x, y := int(hit.X)+direction[0], int(hit.Y)+direction[1]
+			if coordinate, ok := square(x, y); ok {
+				neighbours = append(neighbours, coordinate)
+			}
+
+			// Walk along a line of hits to the first square past the end of it
+			if !lines || !hits[Coordinate{uint8(x), uint8(y)}] {
+				continue
+			}
+			for hits[Coordinate{uint8(x), uint8(y)}] {
+				x, y = x+direction[0], y+direction[1]
+			}
+			if coordinate, ok := square(x, y); ok {
+				lineEnds = append(lineEnds, coordinate)
+			}
+		}
+	}
+
+	if len(lineEnds) > 0 {
+		return lineEnds
+	}
+
+	return neighbours
+}
+
+// hunt returns the untried squares on targetTeam's board. With parity only every other
+// square is returned, unless those have all been tried
+func (bot *Bot) hunt(team *Team, targetTeam *Team, parity bool) []Coordinate {
+
+	tried := triedSquares(team, targetTeam)
+
+	var all, checkerboard []Coordinate
+	for coordinate := range team.Game.BoardCoordinates() {
+		if tried[coordinate] {
+			continue
+		}
+		all = append(all, coordinate)
+		if (coordinate.X+coordinate.Y)%2 == 0 {
+			checkerboard = append(checkerboard, coordinate)
+		}
+	}
+
+	if parity && len(checkerboard) > 0 {
+		return checkerboard
+	}
+
+	return all
+}
+
+// triedSquares returns every square the Team has already fired upon on targetTeam's board
+func triedSquares(team *Team, targetTeam *Team) map[Coordinate]bool {
+	tried := make(map[Coordinate]bool)
+	for _, hit := range team.Hits[targetTeam] {
+		tried[hit] = true
+	}
+	for _, miss := range team.Misses[targetTeam] {
+		tried[miss] = true
+	}
+
+	return tried
+}
@@ -0,0 +1,161 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+/*********************************************************
+ *														 *
+ *                   	  Warships						 *
+ *					   Jason Meredith					 *
+ *														 *
+ *	DATE:		October 18, 2026						 *
+ *	FILE: 		diplomacy.go							 *
+ *	PURPOSE:	Alliances between Teams. Team leaders	 *
+ *				propose and accept alliances, allied	 *
+ *				Teams can't fire on each other and		 *
+ *				betrayals are announced to everyone.	 *
+ *				 										 *
+ *														 *
+ *********************************************************/
+
+// Alliance is a pact between two Teams not to fire on one another
+type Alliance struct {
+	Teams	[2]*Team
+	Formed	time.Time
+}
+
+// AllianceProposal is an offer of an Alliance waiting to be accepted
+type AllianceProposal struct {
+	From	*Team
+	To		*Team
+	Time	time.Time
+}
+
+// Includes returns true if the team is one of the two Teams in the Alliance
+func (alliance *Alliance) Includes(team *Team) bool {
+	return alliance.Teams[0] == team || alliance.Teams[1] == team
+}
+
+// Other returns the Team allied with the given Team
+func (alliance *Alliance) Other(team *Team) *Team {
+	if alliance.Teams[0] == team {
+		return alliance.Teams[1]
+	}
+
+	return alliance.Teams[0]
+}
+
+// GetAlliance returns the Alliance between two Teams, or nil if they aren't allied
+func (game *Game) GetAlliance(teamA, teamB *Team) *Alliance {
+	for _, alliance := range game.Alliances {
+		if alliance.Includes(teamA) && alliance.Includes(teamB) {
+			return alliance
+		}
+	}
+
+	return nil
+}
+
+// Allied returns true if two Teams have an Alliance
+func (game *Game) Allied(teamA, teamB *Team) bool {
+	return game.GetAlliance(teamA, teamB) != nil
+}
+
+// Allies returns every Team allied with the given Team
+func (game *Game) Allies(team *Team) []*Team {
+	var allies []*Team
+
+	for _, alliance := range game.Alliances {
+		if alliance.Includes(team) {
+			allies = append(allies, alliance.Other(team))
+		}
+	}
+
+	return allies
+}
+
+// ProposeAlliance offers an Alliance from one Team to another. If the other Team
+// has already proposed an Alliance to this Team, the Alliance is formed instead
+func (game *Game) ProposeAlliance(from, to *Team) (*Alliance, error) {
+
+	if from == to {
+		return nil, errors.New("your team cannot ally with itself")
+	}
+
+	if game.Allied(from, to) {
+		return nil, errors.New("your teams are already allied")
+	}
+
+	// If they asked us first, that's as good as accepting
+	if game.findProposal(to, from) != -1 {
+		return game.AcceptAlliance(from, to)
+	}
+
+	if game.findProposal(from, to) != -1 {
+		return nil, errors.New("your team has already proposed an alliance to that team")
+	}
+
+	game.AllianceProposals = append(game.AllianceProposals, &AllianceProposal{from, to, time.Now()})
+
+	game.Announce("%v has proposed an alliance with %v", from.Name, to.Name)
+
+	return nil, nil
+}
+
+// AcceptAlliance accepts a proposal made to team by proposer, forming an Alliance
+func (game *Game) AcceptAlliance(team, proposer *Team) (*Alliance, error) {
+
+	index := game.findProposal(proposer, team)
+	if index == -1 {
+		return nil, fmt.Errorf("%v has not proposed an alliance with your team", proposer.Name)
+	}
+
+	game.AllianceProposals = append(game.AllianceProposals[:index], game.AllianceProposals[index+1:]...)
+
+	alliance := &Alliance{[2]*Team{proposer, team}, time.Now()}
+	game.Alliances = append(game.Alliances, alliance)
+
+	game.Announce("%v and %v have formed an alliance!", proposer.Name, team.Name)
+
+	return alliance, nil
+}
+
+// BreakAlliance ends an Alliance, as long as it has lasted at least the Game's
+// AllianceCooldown
+func (game *Game) BreakAlliance(team, ally *Team) error {
+
+	alliance := game.GetAlliance(team, ally)
+	if alliance == nil {
+		return errors.New("your teams are not allied")
+	}
+
+	wait := game.AllianceCooldown - time.Since(alliance.Formed)
+	if wait > 0 {
+		return fmt.Errorf("your alliance is too new to break, you must wait %v", wait.Round(time.Second))
+	}
+
+	for i, existing := range game.Alliances {
+		if existing == alliance {
+			game.Alliances = append(game.Alliances[:i], game.Alliances[i+1:]...)
+			break
+		}
+	}
+
+	game.Announce("Betrayal! %v has broken their alliance with %v", team.Name, ally.Name)
+
+	return nil
+}
+
+// findProposal returns the index of a proposal from one Team to another, or -1
+func (game *Game) findProposal(from, to *Team) int {
+	for i, proposal := range game.AllianceProposals {
+		if proposal.From == from && proposal.To == to {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,141 @@
+package game
+
+import (
+	"fmt"
+	"time"
+)
+
+/*********************************************************
+ *														 *
+ *                   	  Warships						 *
+ *					   Jason Meredith					 *
+ *														 *
+ *	DATE:		October 18, 2026						 *
+ *	FILE: 		events.go								 *
+ *	PURPOSE:	Events sent to Players as they happen.	 *
+ *				Each Event is for a single Team or for	 *
+ *				everyone, Players are sent the ones		 *
+ *				for them they haven't seen yet.			 *
+ *				 										 *
+ *														 *
+ *********************************************************/
+
+// EVENT_HISTORY_SIZE is how many Events the Game keeps. Players who fall further behind
+// than that miss the oldest ones
+const EVENT_HISTORY_SIZE = 500
+
+// EventType is integer used to represent the EventType enum options. Represents what
+// kind of thing happened
+type EventType uint8
+
+// EventType is what an Event is about: a shot fired at a Team, one of a Team's Ships
+// sinking, a Player joining, leaving or switching Teams, or a Team being knocked out or
+// winning the round
+const (
+	EVENT_SHOT EventType = iota
+	EVENT_SINK
+	EVENT_TEAM
+	EVENT_RESULT
+)
+
+// eventTypeNames are the names EventTypes are shown with
+var eventTypeNames = map[EventType]string{
+	EVENT_SHOT:   "SHOT",
+	EVENT_SINK:   "SINK",
+	EVENT_TEAM:   "TEAM",
+	EVENT_RESULT: "RESULT",
+}
+
+// String returns the name of the EventType
+func (eventType EventType) String() string {
+	return eventTypeNames[eventType]
+}
+
+// Event is something that happened in the Game that Players should hear about straight away
+type Event struct {
+	Time	time.Time
+	Type	EventType
+
+	// Only Players on this Team are sent the Event, nil for everyone
+	Team	*Team
+
+	Message	string
+}
+
+// String formats the Event the way it is shown to Players
+func (event Event) String() string {
+	return fmt.Sprintf("[%v] %v", event.Type, event.Message)
+}
+
+// Notify adds a new Event for the Players on a Team, or for everyone if team is nil
+func (game *Game) Notify(team *Team, eventType EventType, format string, a ...interface{}) {
+	game.Events = append(game.Events, Event{
+		Time:    time.Now(),
+		Type:    eventType,
+		Team:    team,
+		Message: fmt.Sprintf(format, a...),
+	})
+
+	if len(game.Events) > EVENT_HISTORY_SIZE {
+		dropped := len(game.Events) - EVENT_HISTORY_SIZE
+		game.Events = append([]Event(nil), game.Events[dropped:]...)
+		game.eventsDropped += dropped
+	}
+}
+
+// EventCount returns how many Events there have ever been in the Game, which is where a
+// Player's EventsSeen starts when they arrive
+func (game *Game) EventCount() int {
+	return game.eventsDropped + len(game.Events)
+}
+
+// UnseenEvents returns every Event for the Player since seen, the number of Events a
+// single Client of theirs has been sent or passed over, and moves seen past them. Each
+// Client keeps its own count so a Player connected twice gets every Event on both. The
+// Player's EventsSeen follows whichever Client is furthest along. Spectators are only
+// sent Events for everyone, once they are older than the spectator delay
+func (game *Game) UnseenEvents(player *Player, seen *int) []Event {
+
+	// Counts include every Event there has been, including ones no longer kept
+	start := *seen - game.eventsDropped
+	if start < 0 {
+		start = 0
+	}
+
+	end := len(game.Events)
+	if player.Spectator {
+		cutoff := game.SpectatorCutoff()
+		for end > start && game.Events[end-1].Time.After(cutoff) {
+			end--
+		}
+	}
+
+	var unseen []Event
+	for _, event := range game.Events[start:end] {
+		if event.Team == nil || (!player.Spectator && event.Team == player.Team) {
+			unseen = append(unseen, event)
+		}
+	}
+
+	*seen = game.eventsDropped + end
+	if *seen > player.EventsSeen {
+		player.EventsSeen = *seen
+	}
+
+	return unseen
+}
+
+// checkWinner tells everyone when a single Team has Ships left afloat, it has won the round
+func (game *Game) checkWinner() {
+
+	var standing []*Team
+	for _, team := range game.Teams {
+		if len(team.Ships) > 0 && !team.Eliminated() {
+			standing = append(standing, team)
+		}
+	}
+
+	if len(standing) == 1 {
+		game.Notify(nil, EVENT_RESULT, "%v is the last team standing and wins the round!", standing[0].Name)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	base26 "github.com/jason-meredith/warships/base26"
 )
@@ -39,6 +40,9 @@ const (
 	DEPLOY_PER_SQ_COST	= 10
 	MOVE_COST			= 1
 	NEW_TEAM_COST		= 200
+
+	// Points deducted from a Player for switching Teams
+	SWITCH_COST			= 20
 )
 
 // Map icons
@@ -55,6 +59,35 @@ const (
 	ICON_HIT = "x"
 )
 
+// CellState is integer used to represent the CellState enum options. Represents what is
+// known about a single square of a board
+type CellState uint8
+
+// CellState is what is in a square: nothing known, a Ship, a Ship that has been hit, a
+// shot that missed, or on a radar a shot that hit
+const (
+	CELL_EMPTY CellState = iota
+	CELL_SHIP
+	CELL_DAMAGED
+	CELL_MISS
+	CELL_HIT
+)
+
+// Icon returns what a square in this state is drawn with on a map
+func (state CellState) Icon() string {
+	switch state {
+	case CELL_SHIP:
+		return string(ICON_ALIVE) + "|"
+	case CELL_DAMAGED:
+		return string(ICON_DEAD) + "|"
+	case CELL_MISS:
+		return ICON_MISS + "|"
+	case CELL_HIT:
+		return ICON_HIT + "|"
+	}
+	return "_|"
+}
+
 // Orientation is integer used to represent the Orientation enum options. Represents
 // the direction a Ship is pointing
 type Orientation uint8
@@ -78,6 +111,19 @@ const (
 	REPEAT_HIT
 )
 
+// shotResultNames are the names ShotResults are shown with
+var shotResultNames = map[ShotResult]string{
+	SINK:       "SINK",
+	HIT:        "HIT",
+	MISS:       "MISS",
+	REPEAT_HIT: "REPEAT HIT",
+}
+
+// String returns the name of the ShotResult
+func (result ShotResult) String() string {
+	return shotResultNames[result]
+}
+
 // Target is the human-way of representing a square most similar to the board game (A1 -> Z26)
 type Target struct {
 	X string
@@ -93,27 +139,115 @@ type Coordinate struct {
 // Game represents a running with all Game settings and teams
 type Game struct {
 
+	// Guards the Game and everything in it, see Lock
+	mutex			sync.Mutex
+
 	// As long as this is true server will keep running
 	Live			bool
 
 	// Game server info
+	Name			string
 	Port			uint16
 	Password		string
 	StartTime		time.Time
 	AdminPassword	string
 
+	// How long a Client session lasts without any activity
+	SessionTimeout	time.Duration
+
+	// How long a Player can go without sending a command before they are
+	// shown as AFK, and before they are treated as having left the Game
+	AfkTimeout		time.Duration
+	DepartedTimeout	time.Duration
+
 	// The maximum ratio as 1:X that teams can be unbalanced
 	// before Players from a short-handed Team can no longer
 	// switch to a loaded Team
+	MaxImbalance	uint8
+
+	// How long a Player must wait after switching Teams before
+	// they can switch again
+	SwitchCooldown	time.Duration
 
 	MaxPlayers		uint8
+
+	// If true, Players who try to join a full Game are put in a waiting
+	// queue instead of being turned away
+	QueueWhenFull	bool
+	WaitQueue		[]*QueueEntry
+
 	ShipLimit		uint8
 	BoardSize		uint8
 
 	Teams			[]*Team
 
+	// Id given to the last Team created, Ids are never reused
+	lastTeamId		int
+
 	StartDeployPts	int
 
+	// Alliances between Teams and offers of alliances not yet accepted
+	Alliances			[]*Alliance
+	AllianceProposals	[]*AllianceProposal
+
+	// How long an Alliance must last before it can be broken
+	AllianceCooldown	time.Duration
+
+	// Offers to merge two Teams not yet accepted
+	MergeProposals		[]*MergeProposal
+
+	// If true, allied Teams see each other's shots on their radar
+	ShareAllyRadar		bool
+
+	// Every Announcement made to the Players, oldest first
+	Announcements		[]Announcement
+
+	// The latest Events sent to the Players, oldest first, and how many older ones
+	// have been dropped, see EVENT_HISTORY_SIZE
+	Events				[]Event
+	eventsDropped		int
+
+	// Players watching the Game without being on a Team
+	Spectators			[]*Player
+
+	// How far behind the live Game spectators see
+	SpectatorDelay		time.Duration
+
+	// Every shot fired in the Game, oldest first
+	ShotLog				[]ShotRecord
+
+	// Players kept out of the Game, saved to BanFile
+	BanFile				string
+	Bans				*BanList
+
+	// Accounts that last between Games, saved to RegistryFile
+	RegistryFile		string
+	Registry			*Registry
+
+	// File every chat message is written to, empty to not log chat
+	ChatLogFile			string
+
+	// If true Clients connect over TLS, with the certificate and key kept in CertFile
+	// and KeyFile
+	TLS					bool
+	CertFile			string
+	KeyFile				string
+
+	// If true the Game is announced on the local network so Players can find it
+	LANDiscovery		bool
+
+}
+
+// Lock takes the Game's lock. Nothing in the game package locks on its own: RPCs are
+// served on their own goroutines, so whoever serves them holds the lock for the whole
+// of each command, making every command a single step no other command can see half done
+func (game *Game) Lock() {
+	game.mutex.Lock()
+}
+
+// Unlock releases the Game's lock, see Lock
+func (game *Game) Unlock() {
+	game.mutex.Unlock()
 }
 
 // Ship represents a single ship
@@ -127,6 +261,9 @@ type Ship struct {
 
 	Health		uint8 // Bit-field representing spots hit on this Ship
 
+	// When the Ship was placed on the board
+	Deployed	time.Time
+
 }
 
 func StringToTarget(targetString string) (Target, error) {
@@ -167,6 +304,8 @@ func FireShot(player *Player, targetTeam *Team, target Target) ShotResult {
 	// Translate Target to an integer-pair Coordinate
 	coordinate := target.ToCoordinate()
 
+	pointsBefore := player.Points
+
 	// If there is a Ship at the given Coordinates, CheckLocation will
 	// return the Ship that is there; otherwise it will return nil.
 	enemyShip := CheckLocation(targetTeam, coordinate)
@@ -176,15 +315,33 @@ func FireShot(player *Player, targetTeam *Team, target Target) ShotResult {
 
 	// If there is no Ship there, return MISS, otherwise mark a HIT on the Ship
 	// and return what hit() returns (HIT or SINK)
+	var result ShotResult
 	if enemyShip == nil {
 		player.HitStreak = 0
 		player.Team.Misses[targetTeam] = append(player.Team.Misses[targetTeam], coordinate)
-		return MISS
+		result = MISS
 	} else {
 		player.Team.Hits[targetTeam] = append(player.Team.Hits[targetTeam], coordinate)
-		return enemyShip.Hit(player, coordinate)
+		result = enemyShip.Hit(player, coordinate)
+	}
+
+	// Log the shot so spectators can be shown the Game as it was
+	game := targetTeam.Game
+	game.ShotLog = append(game.ShotLog, ShotRecord{time.Now(), player.Team, targetTeam, coordinate, result})
+
+	// Let the target Team know they are under fire
+	game.Notify(targetTeam, EVENT_SHOT, "%v of %v fired at %v%v: %v",
+		player.Username, player.Team.Name, target.X, target.Y, result)
+
+	if result == SINK {
+		enemyShip.announceSink(player)
 	}
 
+	// Add the shot to the Player's lifetime stats
+	game.Registry.RecordShot(player, targetTeam, result, player.Points - pointsBefore)
+
+	return result
+
 }
 
 // getOccupyingSpaces returns an array of Coordinates that are occupied by this Ship
@@ -282,6 +439,46 @@ func (ship *Ship) Hit(player *Player, coordinate Coordinate) ShotResult {
 	return HIT
 }
 
+// announceSink tells everyone a Ship has been sunk, and if it was the Team's last Ship
+// that the Team has been eliminated
+func (ship *Ship) announceSink(player *Player) {
+
+	team := ship.Team
+	if team == nil || team.Game == nil {
+		return
+	}
+
+	location := ship.Location.ToTarget()
+	team.Game.Notify(team, EVENT_SINK, "Your size %v ship at %v%v has been sunk", ship.Size, location.X, location.Y)
+
+	if player != nil {
+		team.Game.Announce("%v of %v sank a ship belonging to %v!", player.Username, player.Team.Name, team.Name)
+	} else {
+		team.Game.Announce("A ship belonging to %v has been sunk!", team.Name)
+	}
+
+	if team.Eliminated() {
+		team.Game.Announce("%v has lost its last ship and been eliminated!", team.Name)
+		team.Game.checkWinner()
+	}
+}
+
+// Eliminated returns true if the Team has deployed Ships and every one of them has been sunk
+func (team *Team) Eliminated() bool {
+
+	if len(team.Ships) == 0 {
+		return false
+	}
+
+	for _, ship := range team.Ships {
+		if ship.Health != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
 // NewShip generates a new Ship and adds it to a Team, then returns a pointer to the new Ship
 func (team *Team) NewShip(size uint8, orientation Orientation, coordinate Coordinate) (*Ship, error) {
 
@@ -318,14 +515,15 @@ func (team *Team) NewShip(size uint8, orientation Orientation, coordinate Coordi
 
 	// Create the ship
 	ship := Ship{
-		team,
-		size,
-		orientation,
-		coordinate,
+		Team:        team,
+		Size:        size,
+		Orientation: orientation,
+		Location:    coordinate,
 
 		// Bit field of 1s the length of the Ship Size ie Ship Size 4 -> 11110000, 2 -> 11000000
-		GetHealthBitfield(size),
+		Health: GetHealthBitfield(size),
 
+		Deployed: time.Now(),
 	}
 
 	team.Ships = append(team.Ships, &ship)
@@ -334,6 +532,24 @@ func (team *Team) NewShip(size uint8, orientation Orientation, coordinate Coordi
 	return &ship, nil
 }
 
+// Deploy places a new Ship for the Team, paying for it with the Team's deployment points
+func (team *Team) Deploy(size uint8, orientation Orientation, coordinate Coordinate) (*Ship, error) {
+
+	// Make sure team has enough deployment points
+	if team.DeploymentPoints < int(size) {
+		return nil, errors.New("not enough deployment points")
+	}
+
+	ship, err := team.NewShip(size, orientation, coordinate)
+	if err != nil {
+		return nil, err
+	}
+
+	team.DeploymentPoints -= int(size)
+
+	return ship, nil
+}
+
 // GetHealthBitfield returns a bitfield representing the Ship and thats parts of it that are hit and unscathed.
 func GetHealthBitfield(size uint8) uint8 {
 	return (uint8(math.Pow(2, float64(size))) - 1) << (8 - size)
@@ -362,13 +578,13 @@ func (game *Game) BoardCoordinates() <-chan Coordinate {
 	return channel
 }
 
-// ShipIcon returns, given a Ship and a coordinate, what icon should be
-// displayed at this  coordinate?
-func (ship *Ship) ShipIcon(coordinate Coordinate) rune {
+// ShipCell returns, given a Ship and a coordinate, the state of the Ship
+// at this coordinate
+func (ship *Ship) ShipCell(coordinate Coordinate) CellState {
 	health := ship.Health
 	offset := ship.GetOffset(coordinate)
 
-	var icon rune
+	var state CellState
 
 	// ProduceHitBitmask will produced a binary of all 1s except at the offset
 	// Ex: 3 -> 11111011
@@ -376,18 +592,18 @@ func (ship *Ship) ShipIcon(coordinate Coordinate) rune {
 	// that position in the Health value (1111 1111)&(0000 0100) = that spot
 	// is alive, (1111 1011)&(0000 0100) = that spot is dead
 	if health & ^ProduceHitBitmask(offset) > 0 {
-		icon = ICON_ALIVE
+		state = CELL_SHIP
 	} else {
-		icon = ICON_DEAD
+		state = CELL_DAMAGED
 	}
 
-	return icon
+	return state
 }
 
 type ShipCoord struct {
 	ship 	*Ship
 	coord 	Coordinate
-	icon 	rune
+	state 	CellState
 }
 
 // ShipCoordinates creates an iterator that iterates through the Coordinates
@@ -408,7 +624,7 @@ func (team *Team) ShipCoordinates() chan ShipCoord {
 				shipCoord := ShipCoord{
 					ship: ship,
 					coord: coord,
-					icon: ship.ShipIcon(coord),
+					state: ship.ShipCell(coord),
 				}
 
 				channel <- shipCoord
@@ -430,60 +646,97 @@ func (game *Game) UniqueTeamName(name string) bool {
 	return true
 }
 
+// CheckTeamName makes sure a new Team name isn't taken and can't be mistaken for a Team Id
+func (game *Game) CheckTeamName(name string) error {
 
+	if err := checkTeamNameFormat(name); err != nil {
+		return err
+	}
 
-func (game *Game) GetRadar(team *Team, targetTeam *Team) [][]string {
+	if !game.UniqueTeamName(name) {
+		return errors.New("team name already taken")
+	}
 
-	boardSize := game.BoardSize
+	return nil
+}
 
+// checkTeamNameFormat makes sure a Team name isn't empty or a number
+func checkTeamNameFormat(name string) error {
 
-	board := make([][] string, boardSize)
-	for x := 0; x < int(boardSize); x++ {
-		board[x] = make([] string, boardSize)
+	if name == "" {
+		return errors.New("team name cannot be empty")
 	}
 
-	// Initialize grid with spaces
-	for coord := range game.BoardCoordinates() {
-		board[coord.X][coord.Y] = "_|"
+	if _, err := strconv.Atoi(name); err == nil {
+		return errors.New("team name cannot be a number, numbers are used for team IDs")
 	}
 
-	// Add in hits
-	for _, hit := range team.Hits[targetTeam] {
-		board[hit.X][hit.Y] = ICON_HIT + "|"
-	}
+	return nil
+}
+
+// GetTeam finds a Team by its Id or, failing that, by its name
+func (game *Game) GetTeam(idOrName string) *Team {
 
-	// Add in misses
-	for _, miss := range team.Misses[targetTeam] {
-		board[miss.X][miss.Y] = ICON_MISS + "|"
+	if id, err := strconv.Atoi(idOrName); err == nil {
+		for _, team := range game.Teams {
+			if team.Id == id {
+				return team
+			}
+		}
+		return nil
 	}
 
+	for _, team := range game.Teams {
+		if strings.EqualFold(team.Name, idOrName) {
+			return team
+		}
+	}
 
-	return board
+	return nil
 }
 
-func (game *Game) GetMap(team *Team) [][]string {
 
-	boardSize := game.BoardSize
 
+// GetRadar returns the board of shots a Team has fired on targetTeam. If the Game
+// shares radar between allies, shots fired by allied Teams are included too
+func (game *Game) GetRadar(team *Team, targetTeam *Team) [][]CellState {
+
+	board := game.emptyBoard()
 
-	board := make([][] string, boardSize)
-	for x := 0; x < int(boardSize); x++ {
-		board[x] = make([] string, boardSize)
+	spotters := []*Team{team}
+	if game.ShareAllyRadar {
+		spotters = append(spotters, game.Allies(team)...)
 	}
 
-	// Initialize grid with spaces
-	for coord := range game.BoardCoordinates() {
-		board[coord.X][coord.Y] = "_|"
+	for _, spotter := range spotters {
+
+		// Add in hits
+		for _, hit := range spotter.Hits[targetTeam] {
+			board[hit.X][hit.Y] = CELL_HIT
+		}
+
+		// Add in misses
+		for _, miss := range spotter.Misses[targetTeam] {
+			board[miss.X][miss.Y] = CELL_MISS
+		}
 	}
 
+
+	return board
+}
+
+func (game *Game) GetMap(team *Team) [][]CellState {
+
+	board := game.emptyBoard()
+
 	// Add in shots upon our team
 	for _, miss := range team.ShotsUpon {
-		board[miss.X][miss.Y] = ICON_MISS + "|"
+		board[miss.X][miss.Y] = CELL_MISS
 	}
 
 	// Add in our ships
 	for shipCoord := range team.ShipCoordinates() {
-		board[shipCoord.coord.X][shipCoord.coord.Y] = string(shipCoord.icon) + "|"
+		board[shipCoord.coord.X][shipCoord.coord.Y] = shipCoord.state
 	}
 
 
@@ -3,7 +3,11 @@ package game
 import (
 	"fmt"
 	"math"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func SetupTeam() Team {
@@ -359,7 +363,7 @@ func TestFireShot(t *testing.T) {
 	team := SetupTeam()
 	enemyTeam := team.Game.NewTeam()
 
-	player, _, _ := team.Game.Join("j", "h")
+	player, _, _ := team.Game.Join(JoinRequest{Username: "j", Password: "h"})
 
 	// New Ship details
 	size := uint8(5);
@@ -384,4 +388,856 @@ func TestFireShot(t *testing.T) {
 	if testReHit != REPEAT_HIT {
 		t.Error("FireShot should have REPEAT_HIT")
 	}
-}
\ No newline at end of file
+}
+func TestGame_ChangeTeam(t *testing.T) {
+
+	team := SetupTeam()
+	game := team.Game
+	game.MaxImbalance = 2
+	game.SwitchCooldown = time.Minute
+	game.NewTeam()
+
+	// Join places each Player on the smallest Team, so these end up on opposite Teams
+	playerA, _, _ := game.Join(JoinRequest{Username: "a", Password: "a"})
+	playerB, _, _ := game.Join(JoinRequest{Username: "b", Password: "b"})
+	playerA.Points = 100
+
+	originalTeam := playerA.Team
+	destTeam := playerB.Team
+
+	if err := game.ChangeTeam(playerA, destTeam); err != nil {
+		t.Error("Switch within balance limits should be allowed: ", err)
+	}
+
+	if playerA.Team != destTeam || playerA.PreviousTeam != originalTeam {
+		t.Error("Player Team and PreviousTeam not updated by switch")
+	}
+
+	if playerA.Points != 100 - SWITCH_COST {
+		t.Error("Switching teams should cost SWITCH_COST points")
+	}
+
+	if originalTeam.NumPlayers != 0 || destTeam.NumPlayers != 2 {
+		t.Error("Team player counts not updated by switch")
+	}
+
+	t.Run("Error Check - Cooldown", func(t *testing.T) {
+		if game.ChangeTeam(playerA, originalTeam) == nil {
+			t.Error("Switching again before the cooldown has passed should return error")
+		}
+	})
+
+	t.Run("Error Check - Imbalance", func(t *testing.T) {
+
+		// originalTeam has 1 Player, destTeam has 2
+		playerC, _, _ := game.Join(JoinRequest{Username: "c", Password: "c"})
+
+		// Moving to destTeam would make it 3:1
+		if game.CanSwitch(playerC, destTeam) == nil {
+			t.Error("Switch beyond the max imbalance should return error")
+		}
+
+		// Moving to the short-handed Team makes it 2:1
+		if err := game.CanSwitch(playerB, originalTeam); err != nil {
+			t.Error("Switch to a short-handed Team should be allowed: ", err)
+		}
+	})
+}
+
+func TestGame_Join(t *testing.T) {
+
+	team := SetupTeam()
+	game := team.Game
+	game.Password = "secret"
+	game.MaxPlayers = 1
+
+	_, _, err := game.Join(JoinRequest{Username: "a", Password: "a", ServerPassword: "wrong"})
+	if err != ErrServerPassword {
+		t.Error("Joining with the wrong server password should return ErrServerPassword")
+	}
+
+	_, _, err = game.Join(JoinRequest{Username: "a", Password: "a", ServerPassword: "secret"})
+	if err != nil {
+		t.Error("Joining with the right server password should succeed: ", err)
+	}
+
+	_, _, err = game.Join(JoinRequest{Username: "b", Password: "b", ServerPassword: "secret"})
+	if err != ErrGameFull {
+		t.Error("Joining a full Game should return ErrGameFull")
+	}
+
+	// Returning Players always get back in
+	_, existing, err := game.Join(JoinRequest{Username: "a", Password: "a", ServerPassword: "secret"})
+	if err != nil || !existing {
+		t.Error("Returning Player should be able to rejoin a full Game")
+	}
+
+	t.Run("Waiting Queue", func(t *testing.T) {
+		game.QueueWhenFull = true
+
+		_, _, err := game.Join(JoinRequest{Username: "b", Password: "b", ServerPassword: "secret"})
+		_, _, err = game.Join(JoinRequest{Username: "c", Password: "c", ServerPassword: "secret"})
+		if err == nil || len(game.WaitQueue) != 2 {
+			t.Error("Players joining a full Game should be queued")
+		}
+
+		// Open up a spot, only the Player at the front of the queue should get it
+		game.MaxPlayers = 2
+
+		_, _, err = game.Join(JoinRequest{Username: "c", Password: "c", ServerPassword: "secret"})
+		if err == nil {
+			t.Error("Player further back in the queue should not skip ahead")
+		}
+
+		_, _, err = game.Join(JoinRequest{Username: "b", Password: "b", ServerPassword: "secret"})
+		if err != nil || len(game.WaitQueue) != 1 {
+			t.Error("Player at the front of the queue should get the open spot")
+		}
+	})
+
+	t.Run("Checked Without The Lock", func(t *testing.T) {
+		game.MaxPlayers = 0
+
+		// Two Players check their passwords for the same new username at once
+		first := JoinRequest{Username: "d", Password: "first", ServerPassword: "secret"}
+		second := JoinRequest{Username: "d", Password: "second", ServerPassword: "secret"}
+
+		onFile, registered := game.PasswordOnFile("d")
+		firstCredentials, _ := CheckCredentials(first.Password, onFile, registered)
+		secondCredentials, _ := CheckCredentials(second.Password, onFile, registered)
+
+		if _, _, err := game.Place(first, firstCredentials); err != nil {
+			t.Error("First Player placed should get the username: ", err)
+		}
+
+		if _, _, err := game.Place(second, secondCredentials); err != ErrIncorrectPassword {
+			t.Error("Second Player placed should not take over a username registered in the meantime")
+		}
+	})
+}
+
+func TestHashPassword(t *testing.T) {
+
+	hashA, err := HashPassword("hunter2")
+	if err != nil {
+		t.Error("Error Thrown: ", err)
+	}
+
+	hashB, _ := HashPassword("hunter2")
+
+	if hashA == hashB {
+		t.Error("Same password should hash differently with different salts")
+	}
+
+	if !CheckPassword("hunter2", hashA) || !CheckPassword("hunter2", hashB) {
+		t.Error("Correct password not accepted")
+	}
+
+	if CheckPassword("hunter3", hashA) {
+		t.Error("Incorrect password accepted")
+	}
+
+	if CheckPassword("hunter2", "hunter2") {
+		t.Error("Malformed hash should never match")
+	}
+
+	// Known PBKDF2-HMAC-SHA256 test vector
+	key := pbkdf2([]byte("password"), []byte("salt"), 2, 32)
+	if fmt.Sprintf("%x", key) != "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43" {
+		t.Error("pbkdf2 not producing the expected key")
+	}
+}
+
+func TestGame_JoinPlayerIds(t *testing.T) {
+
+	team := SetupTeam()
+
+	player, _, _ := team.Game.Join(JoinRequest{Username: "j", Password: "h"})
+
+	if player.PasswordHash == "h" || player.Id == RandomId("j", 32) {
+		t.Error("Password or Player ID derived from user input")
+	}
+
+	// A second Game should hand out a different ID to the same username
+	otherTeam := SetupTeam()
+	otherPlayer, _, _ := otherTeam.Game.Join(JoinRequest{Username: "j", Password: "h"})
+
+	if player.Id == otherPlayer.Id {
+		t.Error("Player IDs should be random")
+	}
+
+	rejoined, existing, err := team.Game.Join(JoinRequest{Username: "j", Password: "h"})
+	if err != nil || !existing || rejoined != player {
+		t.Error("Returning Player should be matched by username and password")
+	}
+
+	_, _, err = team.Game.Join(JoinRequest{Username: "j", Password: "x"})
+	if err == nil {
+		t.Error("Returning Player with wrong password should return error")
+	}
+}
+
+func TestGame_Alliances(t *testing.T) {
+
+	team := SetupTeam()
+	game := team.Game
+	game.AllianceCooldown = time.Minute
+	otherTeam := game.NewTeam()
+	enemyTeam := game.NewTeam()
+
+	alliance, err := game.ProposeAlliance(&team, otherTeam)
+	if err != nil || alliance != nil {
+		t.Error("Proposal should be recorded without forming an alliance")
+	}
+
+	if game.Allied(&team, otherTeam) {
+		t.Error("Teams should not be allied until the proposal is accepted")
+	}
+
+	if _, err := game.AcceptAlliance(otherTeam, enemyTeam); err == nil {
+		t.Error("Accepting an alliance that was never proposed should return error")
+	}
+
+	if _, err := game.AcceptAlliance(otherTeam, &team); err != nil {
+		t.Error("Accepting a proposed alliance should succeed: ", err)
+	}
+
+	if !game.Allied(otherTeam, &team) || len(game.Allies(&team)) != 1 {
+		t.Error("Teams should be allied after accepting")
+	}
+
+	if len(game.Announcements) != 2 {
+		t.Error("Proposal and alliance should both be announced")
+	}
+
+	t.Run("Shared Radar", func(t *testing.T) {
+		otherTeam.Hits[enemyTeam] = append(otherTeam.Hits[enemyTeam], Coordinate{1, 1})
+
+		if game.GetRadar(&team, enemyTeam)[1][1] == CELL_HIT {
+			t.Error("Ally shots should not show unless radar sharing is on")
+		}
+
+		game.ShareAllyRadar = true
+		if game.GetRadar(&team, enemyTeam)[1][1] != CELL_HIT {
+			t.Error("Ally shots should show when radar sharing is on")
+		}
+	})
+
+	t.Run("Error Check - Cooldown", func(t *testing.T) {
+		if game.BreakAlliance(&team, otherTeam) == nil {
+			t.Error("Breaking an alliance before the cooldown should return error")
+		}
+
+		game.AllianceCooldown = 0
+		if err := game.BreakAlliance(&team, otherTeam); err != nil || game.Allied(&team, otherTeam) {
+			t.Error("Breaking an alliance after the cooldown should succeed")
+		}
+	})
+}
+
+func TestGame_Invites(t *testing.T) {
+
+	team := SetupTeam()
+	game := team.Game
+	game.MaxImbalance = 2
+	privateTeam := game.NewTeam()
+	privateTeam.InviteOnly = true
+
+	// New Players without a code skip the private Team
+	player, _, _ := game.Join(JoinRequest{Username: "a", Password: "a"})
+	if player.Team == privateTeam {
+		t.Error("Player without an invite code placed on invite only Team")
+	}
+
+	if game.CanSwitch(player, privateTeam) == nil {
+		t.Error("Switching to an invite only Team without a code should return error")
+	}
+
+	code, err := privateTeam.NewInviteCode()
+	if err != nil {
+		t.Error("Error Thrown: ", err)
+	}
+
+	invited, _, err := game.Join(JoinRequest{Username: "b", Password: "b", TeamCode: code})
+	if err != nil || invited.Team != privateTeam {
+		t.Error("Player with an invite code should join the inviting Team")
+	}
+
+	_, _, err = game.Join(JoinRequest{Username: "c", Password: "c", TeamCode: code})
+	if err != ErrInvalidInvite {
+		t.Error("Invite codes should only work once")
+	}
+
+	t.Run("Error Check - Balance", func(t *testing.T) {
+
+		// 2 on the private Team against 1 is as far as a 1:2 limit goes
+		secondCode, _ := privateTeam.NewInviteCode()
+		game.Join(JoinRequest{Username: "d", Password: "d", TeamCode: secondCode})
+
+		thirdCode, _ := privateTeam.NewInviteCode()
+		_, _, err := game.Join(JoinRequest{Username: "e", Password: "e", TeamCode: thirdCode})
+		if err == nil {
+			t.Error("Invite should not let a Team grow beyond the balance limit")
+		}
+
+		if game.FindInvite(thirdCode) != privateTeam {
+			t.Error("Invite code should not be used up by a failed join")
+		}
+	})
+
+	t.Run("Error Check - No Open Team", func(t *testing.T) {
+
+		// With every Team invite only, Players need a code to get in at all
+		game.Teams[0].InviteOnly = true
+		defer func() { game.Teams[0].InviteOnly = false }()
+
+		if _, _, err := game.Join(JoinRequest{Username: "f", Password: "f"}); err != ErrNoOpenTeam {
+			t.Error("Player without an invite code should be turned away when every Team is invite only")
+		}
+		if game.GetPlayerByUsername("f") != nil {
+			t.Error("Turned away Player should not be placed on a private Team")
+		}
+	})
+}
+
+func TestBanList(t *testing.T) {
+
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("warships-bans-%v.json", time.Now().UnixNano()))
+	defer os.Remove(path)
+
+	bans, err := LoadBanList(path)
+	if err != nil || len(bans.Bans) != 0 {
+		t.Error("Missing ban file should load as an empty ban list")
+	}
+
+	bans.Add(&Ban{Username: "j", Address: "10.0.0.1"})
+	bans.Add(&Ban{Username: "k", Expires: time.Now().Add(-time.Minute)})
+
+	// Reload to make sure the bans were saved
+	bans, err = LoadBanList(path)
+	if err != nil {
+		t.Error("Error Thrown: ", err)
+	}
+
+	if bans.Check("j", "") == nil || bans.Check("someone", "10.0.0.1") == nil {
+		t.Error("Ban should match by username and by address")
+	}
+
+	if bans.Check("k", "") != nil {
+		t.Error("Expired ban should not match")
+	}
+
+	team := SetupTeam()
+	team.Game.Bans = bans
+	if _, _, err := team.Game.Join(JoinRequest{Username: "j", Password: "j"}); err == nil {
+		t.Error("Banned player should not be able to join")
+	}
+}
+
+func TestGame_Bots(t *testing.T) {
+
+	team := SetupTeam()
+	game := team.Game
+	game.MaxPlayers = 2
+	enemy := game.NewTeam()
+
+	bot, err := game.AddBot(HARD, enemy)
+	if err != nil || bot.Team != enemy || bot.Bot.Difficulty != HARD {
+		t.Error("Bot should be added to the given Team")
+	}
+
+	if _, err := game.AddBot(EASY, nil); err != nil {
+		t.Error("Error Thrown: ", err)
+	}
+
+	if _, err := game.AddBot(EASY, nil); err != ErrGameFull {
+		t.Error("Bots should not be added past MaxPlayers")
+	}
+
+	// Nobody can log in as a bot
+	if _, _, err := game.Join(JoinRequest{Username: bot.Username}); err == nil {
+		t.Error("Joining as a bot should return error")
+	}
+
+	// A human takes a bot's place in a full Game
+	human, _, err := game.Join(JoinRequest{Username: "human", Password: "human"})
+	if err != nil {
+		t.Error("Error Thrown: ", err)
+	}
+	if game.NumPlayers() != 2 || len(game.Bots()) != 1 {
+		t.Error("A bot should have stepped aside for the human")
+	}
+	if human.Team.TopPlayer() != human {
+		t.Error("Humans should lead their Team over bots")
+	}
+
+	t.Run("Room To Spare", func(t *testing.T) {
+
+		team := SetupTeam()
+		game := team.Game
+		teamA, teamB := game.Teams[0], game.NewTeam()
+
+		game.AddBot(EASY, teamA)
+		game.AddBot(EASY, teamB)
+		game.AddBot(EASY, teamB)
+
+		game.Join(JoinRequest{Username: "a", Password: "a"})
+		if len(game.Bots()) != 3 {
+			t.Error("Bots should keep filling Teams while there is room")
+		}
+
+		game.Join(JoinRequest{Username: "b", Password: "b"})
+		if len(game.Bots()) != 2 || teamA.NumPlayers != 2 || teamB.NumPlayers != 2 {
+			t.Error("A bot should step aside when its Team would be bigger than the others")
+		}
+	})
+
+	t.Run("Targeting", func(t *testing.T) {
+
+		brain := bot.Bot
+
+		// Hard bots follow a line of hits to its ends
+		bot.Team.Hits[&team] = []Coordinate{{5, 5}, {5, 6}}
+		candidates := brain.followUp(bot.Team, &team, true)
+		if len(candidates) != 2 {
+			t.Errorf("Expected 2 squares at the ends of the line, got %v", candidates)
+		}
+		for _, candidate := range candidates {
+			if candidate != (Coordinate{5, 4}) && candidate != (Coordinate{5, 7}) {
+				t.Errorf("Unexpected follow up square %v", candidate)
+			}
+		}
+
+		// Otherwise every untried square around a hit is a candidate
+		bot.Team.Misses[&team] = []Coordinate{{4, 5}}
+		if candidates := brain.followUp(bot.Team, &team, false); len(candidates) != 5 {
+			t.Errorf("Expected 5 squares around the hits, got %v", candidates)
+		}
+
+		// Once the Ship is sunk there is nothing left to follow up on
+		sunk, _ := team.NewShip(2, VERTICAL, Coordinate{5, 5})
+		sunk.Health = 0
+		if candidates := brain.followUp(bot.Team, &team, true); len(candidates) != 0 {
+			t.Errorf("Hits on a sunk Ship should not be followed up, got %v", candidates)
+		}
+
+		// Hunting with parity only tries every other square
+		for _, candidate := range brain.hunt(bot.Team, &team, true) {
+			if (candidate.X+candidate.Y)%2 != 0 {
+				t.Errorf("Parity hunt returned %v", candidate)
+			}
+		}
+	})
+
+	t.Run("Turn", func(t *testing.T) {
+
+		bot.Team.DeploymentPoints = 10
+		shots := len(game.ShotLog)
+
+		// Hard bots fire every turn once they have a Ship
+		game.RunBots()
+		if len(bot.Team.Ships) == 0 {
+			t.Error("Bot should have deployed a Ship")
+		}
+		if bot.Team.DeploymentPoints >= 10 {
+			t.Error("Deploying should have cost the Team points")
+		}
+		if len(game.ShotLog) != shots+1 {
+			t.Error("Hard bot should have fired a shot")
+		}
+	})
+}
+
+func TestGame_Presence(t *testing.T) {
+
+	team := SetupTeam()
+	game := team.Game
+	game.AfkTimeout = time.Minute
+	game.DepartedTimeout = time.Hour
+	otherTeam := game.NewTeam()
+
+	a, _, _ := game.Join(JoinRequest{Username: "a", Password: "a"})
+	b, _, _ := game.Join(JoinRequest{Username: "b", Password: "b"})
+
+	if game.Presence(a) != ONLINE {
+		t.Error("Player who just joined should be online")
+	}
+
+	a.LastActive = time.Now().Add(-2 * time.Minute)
+	if game.Presence(a) != AFK {
+		t.Error("Idle Player should be AFK")
+	}
+
+	a.LastActive = time.Now().Add(-2 * time.Hour)
+	if game.Presence(a) != DEPARTED {
+		t.Error("Long idle Player should be departed")
+	}
+
+	b.Depart()
+	if game.Presence(b) != DEPARTED {
+		t.Error("Player who logged out should be departed")
+	}
+
+	// Both Teams have one departed Player, so balancing treats them as empty
+	if a.Team.ActivePlayers() != 0 || b.Team.ActivePlayers() != 0 {
+		t.Error("Departed Players should not be counted as active")
+	}
+
+	c, _, _ := game.Join(JoinRequest{Username: "c", Password: "c"})
+	d, _, _ := game.Join(JoinRequest{Username: "d", Password: "d"})
+	if c.Team == d.Team {
+		t.Error("New Players should be balanced across Teams ignoring departed Players")
+	}
+
+	// Returning brings a Player back
+	game.Join(JoinRequest{Username: "b", Password: "b"})
+	if game.Presence(b) != ONLINE {
+		t.Error("Returning Player should be online")
+	}
+
+	if game.Teams[0].NumPlayers != 2 || otherTeam.NumPlayers != 2 {
+		t.Error("Departed Players should still be on their Team")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("warships-players-%v.json", time.Now().UnixNano()))
+	defer os.Remove(path)
+
+	registry, err := LoadRegistry(path)
+	if err != nil || len(registry.Accounts) != 0 {
+		t.Error("Missing registry file should load as an empty registry")
+	}
+
+	team := SetupTeam()
+	game := team.Game
+	game.NewTeam()
+	game.Registry = registry
+
+	shooter, _, _ := game.Join(JoinRequest{Username: "a", Password: "a"})
+	target, _, _ := game.Join(JoinRequest{Username: "b", Password: "b"})
+	if shooter.Account == nil || target.Account == nil {
+		t.Error("Joining should register new usernames")
+	}
+
+	target.Team.NewShip(1, VERTICAL, Coordinate{0, 0})
+	if FireShot(shooter, target.Team, Coordinate{0, 0}.ToTarget()) != SINK {
+		t.Error("FireShot should have SUNK")
+	}
+
+	if shooter.Account.Rating <= START_RATING || target.Account.Rating >= START_RATING {
+		t.Error("Sinking a Ship should move ratings from the sunk Team to the shooter")
+	}
+
+	if err := registry.Save(); err != nil {
+		t.Error("Error Thrown: ", err)
+	}
+
+	// A new Game on the same server keeps the accounts
+	registry, err = LoadRegistry(path)
+	if err != nil {
+		t.Error("Error Thrown: ", err)
+	}
+
+	nextTeam := SetupTeam()
+	nextGame := nextTeam.Game
+	nextGame.Registry = registry
+
+	if _, _, err := nextGame.Join(JoinRequest{Username: "a", Password: "wrong"}); err == nil {
+		t.Error("Registered username with the wrong password should return error")
+	}
+
+	returning, _, err := nextGame.Join(JoinRequest{Username: "a", Password: "a"})
+	if err != nil {
+		t.Error("Error Thrown: ", err)
+	}
+
+	stats := returning.Account.Stats
+	if stats.GamesPlayed != 2 || stats.ShotsFired != 1 || stats.Sinks != 1 || stats.PointsEarned == 0 {
+		t.Errorf("Lifetime stats were not kept, got %+v", stats)
+	}
+
+	// Spectating with a registered username needs its password too
+	if _, _, err := nextGame.Join(JoinRequest{Username: "b", Password: "wrong", Spectator: true}); err == nil {
+		t.Error("Spectating as a registered username with the wrong password should return error")
+	}
+}
+
+func TestGame_Merge(t *testing.T) {
+
+	team := SetupTeam()
+	game := team.Game
+	keep := game.Teams[0]
+	absorbed := game.NewTeam()
+	enemy := game.NewTeam()
+
+	a, _, _ := game.Join(JoinRequest{Username: "a", Password: "a"})
+	b, _, _ := game.Join(JoinRequest{Username: "b", Password: "b"})
+	e, _, _ := game.Join(JoinRequest{Username: "e", Password: "e"})
+
+	keep.NewShip(3, HORIZONTAL, Coordinate{0, 0})
+	keep.NewShip(2, VERTICAL, Coordinate{5, 5})
+	absorbed.NewShip(3, HORIZONTAL, Coordinate{0, 0})
+	keep.DeploymentPoints, absorbed.DeploymentPoints = 5, 7
+
+	FireShot(e, absorbed, Coordinate{0, 0}.ToTarget())
+	FireShot(e, absorbed, Coordinate{5, 5}.ToTarget())
+	FireShot(b, enemy, Coordinate{9, 9}.ToTarget())
+	game.ProposeAlliance(absorbed, enemy)
+	game.AcceptAlliance(enemy, absorbed)
+
+	if _, err := game.ProposeMerge(keep, absorbed, enemy.Name); err == nil {
+		t.Error("Merging under another Team's name should return error")
+	}
+
+	merged, err := game.ProposeMerge(keep, absorbed, "Armada")
+	if err != nil || merged != nil {
+		t.Error("Proposing a merge should not merge the Teams yet")
+	}
+
+	merged, err = game.AcceptMerge(absorbed, keep)
+	if err != nil || merged != keep {
+		t.Fatal("Accepting a merge should merge the Teams: ", err)
+	}
+
+	if len(game.Teams) != 2 || keep.Name != "Armada" {
+		t.Error("Absorbed Team should be removed and the merged Team renamed")
+	}
+
+	if a.Team != keep || b.Team != keep || keep.NumPlayers != 2 {
+		t.Error("Players should be moved to the merged Team")
+	}
+
+	if len(keep.Ships) != 3 || keep.Ships[2].Team != keep || keep.Ships[2].Location == keep.Ships[0].Location {
+		t.Error("Ships should be combined without overlapping")
+	}
+
+	if keep.DeploymentPoints != 12 {
+		t.Error("Deployment points should be combined")
+	}
+
+	if len(keep.Misses[enemy]) != 1 {
+		t.Error("Shots fired by the absorbed Team should be kept")
+	}
+
+	if _, exists := enemy.Hits[absorbed]; exists || len(enemy.Hits[keep]) != 1 {
+		t.Error("Other Teams' shots on the absorbed Team should be redirected to the merged Team")
+	}
+
+	// The absorbed Ship was moved off the kept one, and the hit on it moves with it
+	moved := keep.Ships[2].Location
+	for _, radar := range [][][]CellState{game.GetRadar(enemy, keep), game.GetRadarAt(enemy, keep, time.Now())} {
+		if radar[moved.X][moved.Y] != CELL_HIT || radar[0][0] != CELL_EMPTY {
+			t.Error("Radar should show the hit on the moved Ship, not on the kept Ship")
+		}
+
+		// The miss on the absorbed Team's board landed where a kept Ship is
+		if radar[5][5] != CELL_EMPTY {
+			t.Error("Radar should not show a miss over one of the merged Team's Ships")
+		}
+	}
+	if len(enemy.Misses[keep]) != 0 {
+		t.Error("Misses under the merged Team's Ships should be dropped")
+	}
+	if board := game.GetMap(keep); board[moved.X][moved.Y] != CELL_DAMAGED || board[0][0] != CELL_SHIP {
+		t.Error("Merged Team's map should show the damage on the moved Ship only")
+	}
+
+	if !game.Allied(keep, enemy) {
+		t.Error("Alliances should carry over to the merged Team")
+	}
+
+	if _, err := game.ProposeMerge(keep, enemy, "Everyone"); err != nil {
+		t.Error("Error Thrown: ", err)
+	}
+	if _, err := game.AcceptMerge(enemy, keep); err == nil {
+		t.Error("Merging the last two Teams should return error")
+	}
+}
+
+func TestGame_MergeLimits(t *testing.T) {
+
+	team := SetupTeam()
+	game := team.Game
+	teamA := game.Teams[0]
+	teamB := game.NewTeam()
+	game.NewTeam()
+
+	game.Join(JoinRequest{Username: "a", Password: "a"})
+	game.Join(JoinRequest{Username: "b", Password: "b"})
+	game.Join(JoinRequest{Username: "c", Password: "c"})
+
+	teamA.NewShip(2, HORIZONTAL, Coordinate{0, 0})
+	teamB.NewShip(2, HORIZONTAL, Coordinate{0, 0})
+
+	game.ShipLimit = 1
+	if _, err := game.ProposeMerge(teamA, teamB, "Armada"); err == nil {
+		t.Error("Merge that would go over the ShipLimit should return error")
+	}
+
+	game.ShipLimit = 2
+	if _, err := game.ProposeMerge(teamA, teamB, "Armada"); err != nil {
+		t.Error("Merge within the ShipLimit should be proposed: ", err)
+	}
+
+	// The rules can change before the merge is accepted
+	game.MaxImbalance = 1
+	if _, err := game.AcceptMerge(teamB, teamA); err == nil {
+		t.Error("Merge that would unbalance the Teams beyond MaxImbalance should return error")
+	}
+
+	game.MaxImbalance = 2
+	if merged, err := game.AcceptMerge(teamB, teamA); err != nil || merged != teamA {
+		t.Error("Merge within MaxImbalance should be accepted: ", err)
+	}
+}
+
+func TestGame_TeamIds(t *testing.T) {
+
+	team := SetupTeam()
+	game := team.Game
+	second := game.NewTeam()
+	third := game.NewTeam()
+
+	if game.Teams[0].Id != 1 || second.Id != 2 || third.Id != 3 {
+		t.Error("Teams should be given Ids in the order they're created")
+	}
+
+	// Removing a Team must not change the Ids of the others
+	game.ProposeMerge(game.Teams[0], second, "Armada")
+	game.AcceptMerge(second, game.Teams[0])
+
+	if game.GetTeam("3") != third || game.GetTeam("2") != nil {
+		t.Error("Team Ids should not change when other Teams are removed")
+	}
+
+	if game.NewTeam().Id != 4 {
+		t.Error("Team Ids should never be reused")
+	}
+
+	if game.GetTeam("armada") != game.Teams[0] {
+		t.Error("Teams should be found by name")
+	}
+
+	if game.CheckTeamName("42") == nil {
+		t.Error("Numeric team names should return error")
+	}
+
+	if game.CheckTeamName("Armada") == nil {
+		t.Error("Taken team names should return error")
+	}
+}
+
+func TestShip_HitAnnouncements(t *testing.T) {
+
+	team := SetupTeam()
+	game := team.Game
+	enemyTeam := game.NewTeam()
+
+	player, _, _ := game.Join(JoinRequest{Username: "j", Password: "j"})
+	enemyTeam.NewShip(1, VERTICAL, Coordinate{0, 0})
+	enemyTeam.NewShip(1, VERTICAL, Coordinate{5, 5})
+
+	FireShot(player, enemyTeam, Coordinate{0, 0}.ToTarget())
+	if len(game.Announcements) != 1 || !strings.Contains(game.Announcements[0].Message, "sank a ship") {
+		t.Error("Sinking a Ship should be announced")
+	}
+
+	if enemyTeam.Eliminated() {
+		t.Error("Team with a Ship left should not be eliminated")
+	}
+
+	FireShot(player, enemyTeam, Coordinate{5, 5}.ToTarget())
+	if !enemyTeam.Eliminated() || len(game.Announcements) != 3 ||
+		!strings.Contains(game.Announcements[2].Message, "eliminated") {
+		t.Error("Sinking a Team's last Ship should announce it has been eliminated")
+	}
+}
+
+func TestGame_Events(t *testing.T) {
+
+	team := SetupTeam()
+	game := team.Game
+	game.NewTeam()
+	teamA, teamB := game.Teams[0], game.Teams[1]
+
+	playerA, _, _ := game.Join(JoinRequest{Username: "a", Password: "a"})
+	playerB, _, _ := game.Join(JoinRequest{Username: "b", Password: "b"})
+	spectator, _, _ := game.Join(JoinRequest{Username: "s", Password: "s", Spectator: true})
+	seenA, seenB, seenS := playerA.EventsSeen, playerB.EventsSeen, spectator.EventsSeen
+
+	if len(game.UnseenEvents(playerA, &seenA)) != 0 || len(game.UnseenEvents(playerB, &seenB)) != 0 {
+		t.Error("Players should not hear about their own arrival or Players joining other Teams")
+	}
+
+	teamA.NewShip(1, VERTICAL, Coordinate{3, 3})
+	teamB.NewShip(1, VERTICAL, Coordinate{0, 0})
+	FireShot(playerA, teamB, Coordinate{0, 0}.ToTarget())
+
+	events := game.UnseenEvents(playerB, &seenB)
+	if len(events) != 3 || events[0].Type != EVENT_SHOT || events[1].Type != EVENT_SINK || events[2].Type != EVENT_RESULT {
+		t.Fatal("Target Team should hear about the shot, the sink and the result: ", events)
+	}
+	if events[0].String() != "[SHOT] a of "+teamA.Name+" fired at A0: SINK" {
+		t.Error("Unexpected shot event: ", events[0])
+	}
+	if !strings.Contains(events[2].Message, teamA.Name+" is the last team standing") {
+		t.Error("Last Team with Ships afloat should win the round: ", events[2])
+	}
+
+	if events := game.UnseenEvents(playerA, &seenA); len(events) != 1 || events[0].Type != EVENT_RESULT {
+		t.Error("Firing Team should only hear the result: ", events)
+	}
+	if events := game.UnseenEvents(spectator, &seenS); len(events) != 1 || events[0].Type != EVENT_RESULT {
+		t.Error("Spectators should only hear Events for everyone: ", events)
+	}
+
+	if len(game.UnseenEvents(playerB, &seenB)) != 0 {
+		t.Error("Events should only be sent once")
+	}
+
+	game.ChangeTeam(playerA, teamB)
+	if events := game.UnseenEvents(playerB, &seenB); len(events) != 1 || events[0].Message != "a joined from "+teamA.Name {
+		t.Error("Players should hear about Players switching to their Team: ", events)
+	}
+
+	t.Run("Clients", func(t *testing.T) {
+
+		// A Player connected twice gets every Event on both Clients
+		other := playerB.EventsSeen
+		game.Notify(nil, EVENT_RESULT, "twice")
+		if len(game.UnseenEvents(playerB, &seenB)) != 1 || len(game.UnseenEvents(playerB, &other)) != 1 {
+			t.Error("Each Client should be sent the Event")
+		}
+		if playerB.EventsSeen != seenB {
+			t.Error("Player's EventsSeen should follow their furthest along Client")
+		}
+	})
+
+	t.Run("History", func(t *testing.T) {
+
+		// Only the latest Events are kept, and Players who are caught up stay caught up
+		game.Notify(nil, EVENT_RESULT, "first")
+		if len(game.UnseenEvents(playerB, &seenB)) != 1 {
+			t.Error("Player should hear the first Event")
+		}
+
+		for i := 0; i < EVENT_HISTORY_SIZE + 10; i++ {
+			game.Notify(nil, EVENT_RESULT, "round %v", i)
+		}
+		if len(game.Events) != EVENT_HISTORY_SIZE {
+			t.Errorf("Game should keep %v Events, kept %v", EVENT_HISTORY_SIZE, len(game.Events))
+		}
+
+		events := game.UnseenEvents(playerB, &seenB)
+		if len(events) != EVENT_HISTORY_SIZE || events[0].Message != "round 10" {
+			t.Error("Player who fell behind should get every Event still kept")
+		}
+
+		game.Notify(nil, EVENT_RESULT, "last")
+		if events := game.UnseenEvents(playerB, &seenB); len(events) != 1 || events[0].Message != "last" {
+			t.Error("Player should only hear Events since they last checked: ", events)
+		}
+	})
+}
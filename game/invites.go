@@ -0,0 +1,114 @@
+package game
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+/*********************************************************
+ *														 *
+ *                   	  Warships						 *
+ *					   Jason Meredith					 *
+ *														 *
+ *	DATE:		October 18, 2026						 *
+ *	FILE: 		invites.go								 *
+ *	PURPOSE:	Private Teams. A Team leader can close	 *
+ *				their Team to everyone but Players they	 *
+ *				hand an invite code to, new Players can	 *
+ *				use the code to join and existing ones	 *
+ *				to switch over.							 *
+ *				 										 *
+ *														 *
+ *********************************************************/
+
+const (
+	// INVITE_CODE_LIFETIME is how long an invite code can be used after it's made
+	INVITE_CODE_LIFETIME = time.Hour
+
+	// INVITE_CODE_SIZE is the number of random bytes in an invite code
+	INVITE_CODE_SIZE = 4
+)
+
+// ErrInvalidInvite is returned when an invite code doesn't match any Team
+var ErrInvalidInvite = errors.New("invite code is invalid or has expired")
+
+// NewInviteCode creates a single-use invite code for the Team
+func (team *Team) NewInviteCode() (string, error) {
+
+	code, err := randomBytes(INVITE_CODE_SIZE)
+	if err != nil {
+		return "", err
+	}
+
+	inviteCode := strings.ToUpper(hex.EncodeToString(code))
+	team.InviteCodes[inviteCode] = time.Now().Add(INVITE_CODE_LIFETIME)
+
+	return inviteCode, nil
+}
+
+// FindInvite returns the Team an invite code belongs to, or nil if no Team has
+// a live invite with that code
+func (game *Game) FindInvite(code string) *Team {
+	code = strings.ToUpper(code)
+
+	for _, team := range game.Teams {
+		if expires, exists := team.InviteCodes[code]; exists {
+			if time.Now().Before(expires) {
+				return team
+			}
+
+			delete(team.InviteCodes, code)
+		}
+	}
+
+	return nil
+}
+
+// UseInviteCode moves an existing Player to the Team the invite code belongs to. The
+// code gets them past the Team being invite only, but switch cooldowns and balance
+// limits still apply
+func (game *Game) UseInviteCode(player *Player, code string) (*Team, error) {
+
+	team := game.FindInvite(code)
+	if team == nil {
+		return nil, ErrInvalidInvite
+	}
+
+	if err := game.changeTeam(player, team, true); err != nil {
+		return nil, err
+	}
+
+	delete(team.InviteCodes, strings.ToUpper(code))
+
+	return team, nil
+}
+
+// checkNewcomerBalance makes sure a new Player joining team won't leave it more than
+// 1:MaxImbalance bigger than the smallest other Team
+func (game *Game) checkNewcomerBalance(team *Team) error {
+
+	if game.MaxImbalance == 0 {
+		return nil
+	}
+
+	smallest := -1
+	for _, other := range game.Teams {
+		if other != team && (smallest == -1 || other.ActivePlayers() < smallest) {
+			smallest = other.ActivePlayers()
+		}
+	}
+
+	if smallest < 1 {
+		smallest = 1
+	}
+
+	if team.ActivePlayers() + 1 > int(game.MaxImbalance) * smallest {
+		return fmt.Errorf("%v is too full to take another player without unbalancing the teams beyond 1:%v",
+			team.Name, game.MaxImbalance)
+	}
+
+	return nil
+}
@@ -0,0 +1,389 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+/*********************************************************
+ *														 *
+ *                   	  Warships						 *
+ *					   Jason Meredith					 *
+ *														 *
+ *	DATE:		October 18, 2026						 *
+ *	FILE: 		merge.go								 *
+ *	PURPOSE:	Team merges. When both Team leaders		 *
+ *				agree two Teams become one, taking		 *
+ *				everything from both and pointing every	 *
+ *				reference to the absorbed Team at the	 *
+ *				merged one.								 *
+ *				 										 *
+ *														 *
+ *********************************************************/
+
+// MergeProposal is an offer to merge two Teams waiting to be accepted
+type MergeProposal struct {
+	From	*Team
+	To		*Team
+
+	// Name of the merged Team
+	Name	string
+	Time	time.Time
+}
+
+// ProposeMerge offers to merge one Team with another under a new name. If the other
+// Team has already proposed a merge with this Team, the Teams are merged instead
+func (game *Game) ProposeMerge(from, to *Team, name string) (*Team, error) {
+
+	if from == to {
+		return nil, errors.New("your team cannot merge with itself")
+	}
+
+	// If they asked us first, that's as good as accepting
+	if game.findMergeProposal(to, from) != -1 {
+		return game.AcceptMerge(from, to)
+	}
+
+	if game.findMergeProposal(from, to) != -1 {
+		return nil, errors.New("your team has already proposed a merge with that team")
+	}
+
+	if err := game.checkMergeName(from, to, name); err != nil {
+		return nil, err
+	}
+
+	if err := game.checkMergeLimits(from, to); err != nil {
+		return nil, err
+	}
+
+	game.MergeProposals = append(game.MergeProposals, &MergeProposal{from, to, name, time.Now()})
+
+	game.Announce("%v has proposed merging with %v to form %v", from.Name, to.Name, name)
+
+	return nil, nil
+}
+
+// AcceptMerge accepts a merge proposed to team by proposer. The proposing Team takes in
+// the other Team and is renamed to the proposed name
+func (game *Game) AcceptMerge(team, proposer *Team) (*Team, error) {
+
+	index := game.findMergeProposal(proposer, team)
+	if index == -1 {
+		return nil, fmt.Errorf("%v has not proposed a merge with your team", proposer.Name)
+	}
+
+	proposal := game.MergeProposals[index]
+
+	if len(game.Teams) < 3 {
+		return nil, errors.New("merging would leave no other teams to fight")
+	}
+
+	// Another Team may have taken the name since it was proposed
+	if err := game.checkMergeName(proposer, team, proposal.Name); err != nil {
+		return nil, err
+	}
+
+	// Ships and Players may have come and gone since it was proposed too
+	if err := game.checkMergeLimits(proposer, team); err != nil {
+		return nil, err
+	}
+
+	oldNames := [2]string{proposer.Name, team.Name}
+
+	game.mergeTeams(proposer, team)
+	proposer.Name = proposal.Name
+
+	game.Announce("%v and %v have merged to form %v!", oldNames[0], oldNames[1], proposer.Name)
+
+	return proposer, nil
+}
+
+// MergeProposalsFor returns every merge proposal made to or by a Team
+func (game *Game) MergeProposalsFor(team *Team) []*MergeProposal {
+	var proposals []*MergeProposal
+	for _, proposal := range game.MergeProposals {
+		if proposal.From == team || proposal.To == team {
+			proposals = append(proposals, proposal)
+		}
+	}
+
+	return proposals
+}
+
+// checkMergeName makes sure a merged Team name isn't used by any Team other than the two merging
+func (game *Game) checkMergeName(teamA, teamB *Team, name string) error {
+
+	if err := checkTeamNameFormat(name); err != nil {
+		return err
+	}
+
+	for _, team := range game.Teams {
+		if team != teamA && team != teamB && team.Name == name {
+			return errors.New("team name already in use")
+		}
+	}
+
+	return nil
+}
+
+// checkMergeLimits makes sure the merged Team would stay within the ShipLimit, and wouldn't
+// be more than 1:MaxImbalance bigger than the smallest other Team
+func (game *Game) checkMergeLimits(teamA, teamB *Team) error {
+
+	ships := len(teamA.Ships) + len(teamB.Ships)
+	if game.ShipLimit != 0 && ships > int(game.ShipLimit) {
+		return fmt.Errorf("merging would leave the team with %v ships, the limit is %v", ships, game.ShipLimit)
+	}
+
+	// A MaxImbalance of 0 means there is no limit. Departed Players aren't counted
+	if game.MaxImbalance == 0 {
+		return nil
+	}
+
+	smallest := -1
+	for _, other := range game.Teams {
+		if other != teamA && other != teamB && (smallest == -1 || other.ActivePlayers() < smallest) {
+			smallest = other.ActivePlayers()
+		}
+	}
+
+	if smallest < 1 {
+		smallest = 1
+	}
+
+	if teamA.ActivePlayers() + teamB.ActivePlayers() > int(game.MaxImbalance) * smallest {
+		return fmt.Errorf("merging would unbalance the teams beyond 1:%v", game.MaxImbalance)
+	}
+
+	return nil
+}
+
+// mergeTeams moves everything from absorbed into keep and removes absorbed from the Game
+func (game *Game) mergeTeams(keep, absorbed *Team) {
+
+	// Players
+	for _, player := range absorbed.Players {
+		player.Team = keep
+		keep.Players = append(keep.Players, player)
+	}
+	keep.NumPlayers += absorbed.NumPlayers
+
+	// Ships, moving any that overlap the kept Team's Ships. Shots that landed on a
+	// moved Ship are moved with it, and shots on a Ship with no room left are dropped
+	moved := make(map[Coordinate]Coordinate)
+	removed := make(map[Coordinate]bool)
+	for _, ship := range absorbed.Ships {
+		spaces := ship.GetOccupyingSpaces()
+		if keep.placeMergedShip(ship) {
+			keep.Ships = append(keep.Ships, ship)
+			for i, space := range ship.GetOccupyingSpaces() {
+				if space != spaces[i] {
+					moved[spaces[i]] = space
+				}
+			}
+		} else {
+			// No room left on the board, the Team gets the points back instead
+			keep.DeploymentPoints += int(ship.Size)
+			for _, space := range spaces {
+				removed[space] = true
+			}
+		}
+	}
+
+	// relocate returns shots on the absorbed Team where they land on the merged Team
+	relocate := func(shots []Coordinate) []Coordinate {
+		var relocated []Coordinate
+		for _, shot := range shots {
+			if removed[shot] {
+				continue
+			}
+			if to, exists := moved[shot]; exists {
+				shot = to
+			}
+			relocated = append(relocated, shot)
+		}
+		return relocated
+	}
+
+	keep.DeploymentPoints += absorbed.DeploymentPoints
+	keep.ShotsUpon = append(keep.ShotsUpon, relocate(absorbed.ShotsUpon)...)
+
+	for code, expires := range absorbed.InviteCodes {
+		keep.InviteCodes[code] = expires
+	}
+
+	// Shots the absorbed Team fired become the merged Team's. Shots the two Teams
+	// fired on each other are now shots on themselves, so they're dropped
+	for target, hits := range absorbed.Hits {
+		if target != keep && target != absorbed {
+			keep.Hits[target] = append(keep.Hits[target], hits...)
+		}
+	}
+	for target, misses := range absorbed.Misses {
+		if target != keep && target != absorbed {
+			keep.Misses[target] = append(keep.Misses[target], misses...)
+		}
+	}
+	delete(keep.Hits, absorbed)
+	delete(keep.Misses, absorbed)
+
+	// Shots other Teams fired upon the absorbed Team now show on their radar for the merged Team
+	for _, other := range game.Teams {
+		if other == keep || other == absorbed {
+			continue
+		}
+
+		if hits, exists := other.Hits[absorbed]; exists {
+			other.Hits[keep] = append(other.Hits[keep], relocate(hits)...)
+			delete(other.Hits, absorbed)
+		}
+		if misses, exists := other.Misses[absorbed]; exists {
+			other.Misses[keep] = append(other.Misses[keep], misses...)
+			delete(other.Misses, absorbed)
+		}
+
+		// A miss on one of the two boards can now sit under a Ship from the other,
+		// so it's dropped rather than shown on radar over a live Ship
+		if misses, exists := other.Misses[keep]; exists {
+			var kept []Coordinate
+			for _, miss := range misses {
+				if CheckLocation(keep, miss) == nil {
+					kept = append(kept, miss)
+				}
+			}
+			other.Misses[keep] = kept
+		}
+	}
+
+	var shotLog []ShotRecord
+	for _, shot := range game.ShotLog {
+		if shot.From == absorbed {
+			shot.From = keep
+		}
+		if shot.To == absorbed {
+			if shot.Result != MISS && removed[shot.Coordinate] {
+				continue
+			}
+			if to, exists := moved[shot.Coordinate]; exists && shot.Result != MISS {
+				shot.Coordinate = to
+			}
+			shot.To = keep
+		}
+		if shot.To == keep && shot.Result == MISS && CheckLocation(keep, shot.Coordinate) != nil {
+			continue
+		}
+		shotLog = append(shotLog, shot)
+	}
+	game.ShotLog = shotLog
+
+	// Events the absorbed Team's Players haven't been sent yet still reach them
+	for i := range game.Events {
+		if game.Events[i].Team == absorbed {
+			game.Events[i].Team = keep
+		}
+	}
+
+	for _, team := range game.Teams {
+		for _, player := range team.Players {
+			if player.PreviousTeam == absorbed {
+				player.PreviousTeam = keep
+			}
+		}
+	}
+
+	// Alliances carry over unless they were with the other merging Team, or the
+	// kept Team already has one with that Team
+	var alliances []*Alliance
+	for _, alliance := range game.Alliances {
+		if alliance.Includes(absorbed) {
+			other := alliance.Other(absorbed)
+			if other == keep || game.Allied(keep, other) {
+				continue
+			}
+			alliance.Teams = [2]*Team{keep, other}
+		}
+		alliances = append(alliances, alliance)
+	}
+	game.Alliances = alliances
+
+	// Outstanding proposals for either Team no longer make sense
+	var allianceProposals []*AllianceProposal
+	for _, proposal := range game.AllianceProposals {
+		if proposal.From != absorbed && proposal.To != absorbed {
+			allianceProposals = append(allianceProposals, proposal)
+		}
+	}
+	game.AllianceProposals = allianceProposals
+
+	var mergeProposals []*MergeProposal
+	for _, proposal := range game.MergeProposals {
+		if proposal.From != absorbed && proposal.To != absorbed && proposal.From != keep && proposal.To != keep {
+			mergeProposals = append(mergeProposals, proposal)
+		}
+	}
+	game.MergeProposals = mergeProposals
+
+	for i, team := range game.Teams {
+		if team == absorbed {
+			game.Teams = append(game.Teams[:i], game.Teams[i+1:]...)
+			break
+		}
+	}
+}
+
+// placeMergedShip gives a Ship from a merging Team a place on this Team's board. It
+// keeps its spot if it's free, otherwise it's moved to the first spot that is. Returns
+// false if there is nowhere to put it
+func (team *Team) placeMergedShip(ship *Ship) bool {
+
+	original := ship.Location
+	ship.Team = team
+
+	if team.shipFits(ship) {
+		return true
+	}
+
+	for x := uint8(0); x < team.Game.BoardSize; x++ {
+		for y := uint8(0); y < team.Game.BoardSize; y++ {
+			ship.Location = Coordinate{x, y}
+			if team.shipFits(ship) {
+				return true
+			}
+		}
+	}
+
+	ship.Location = original
+	return false
+}
+
+// shipFits returns true if a Ship is inside the board and doesn't overlap any of the Team's Ships
+func (team *Team) shipFits(ship *Ship) bool {
+
+	size := team.Game.BoardSize
+	if ship.Orientation == HORIZONTAL && int(ship.Location.X) + int(ship.Size) > int(size) {
+		return false
+	}
+	if ship.Orientation == VERTICAL && int(ship.Location.Y) + int(ship.Size) > int(size) {
+		return false
+	}
+
+	for _, coordinate := range ship.GetOccupyingSpaces() {
+		if CheckLocation(team, coordinate) != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// findMergeProposal returns the index of a merge proposal from one Team to another, or -1
+func (game *Game) findMergeProposal(from, to *Team) int {
+	for i, proposal := range game.MergeProposals {
+		if proposal.From == from && proposal.To == to {
+			return i
+		}
+	}
+
+	return -1
+}
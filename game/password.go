@@ -0,0 +1,157 @@
+package game
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*********************************************************
+ *														 *
+ *                   	  Warships						 *
+ *					   Jason Meredith					 *
+ *														 *
+ *	DATE:		October 18, 2026						 *
+ *	FILE: 		password.go								 *
+ *	PURPOSE:	Salted password hashing and random ID	 *
+ *				generation. Passwords are stretched with *
+ *				PBKDF2-HMAC-SHA256, written by hand on	 *
+ *				top of the standard crypto packages		 *
+ *				 										 *
+ *														 *
+ *********************************************************/
+
+const (
+	// HASH_ITERATIONS is how many rounds of HMAC-SHA256 each password goes through.
+	// Higher is slower for us but much slower for anyone trying to brute force
+	HASH_ITERATIONS = 100000
+
+	// HASH_SALT_SIZE is the number of random bytes used to salt each password
+	HASH_SALT_SIZE = 16
+
+	// HASH_KEY_SIZE is the length in bytes of the derived key
+	HASH_KEY_SIZE = 32
+
+	// HASH_SCHEME identifies how a stored hash was produced
+	HASH_SCHEME = "pbkdf2-sha256"
+
+	// PLAYER_ID_SIZE is the number of random bytes in a Player ID
+	PLAYER_ID_SIZE = 16
+)
+
+// HashPassword salts and stretches a password, returning a string containing everything
+// needed to check it later: scheme$iterations$salt$key
+func HashPassword(password string) (string, error) {
+
+	salt, err := randomBytes(HASH_SALT_SIZE)
+	if err != nil {
+		return "", err
+	}
+
+	key := pbkdf2([]byte(password), salt, HASH_ITERATIONS, HASH_KEY_SIZE)
+
+	return fmt.Sprintf("%v$%v$%v$%v",
+		HASH_SCHEME,
+		HASH_ITERATIONS,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// CheckPassword returns true if password produces the same key as the stored hash
+func CheckPassword(password, hash string) bool {
+
+	fields := strings.Split(hash, "$")
+	if len(fields) != 4 || fields[0] != HASH_SCHEME {
+		return false
+	}
+
+	iterations, err := strconv.Atoi(fields[1])
+	if err != nil || iterations < 1 {
+		return false
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(fields[2])
+	if err != nil {
+		return false
+	}
+
+	expected, err := base64.RawStdEncoding.DecodeString(fields[3])
+	if err != nil {
+		return false
+	}
+
+	key := pbkdf2([]byte(password), salt, iterations, len(expected))
+
+	// Compare in constant time so the time taken doesn't leak how much matched
+	return subtle.ConstantTimeCompare(key, expected) == 1
+}
+
+// NewPlayerId generates a random, unguessable Player ID
+func NewPlayerId() (string, error) {
+
+	id, err := randomBytes(PLAYER_ID_SIZE)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(id), nil
+}
+
+// randomBytes reads n bytes from the operating system's secure random source
+func randomBytes(n int) ([]byte, error) {
+	buffer := make([]byte, n)
+
+	if _, err := rand.Read(buffer); err != nil {
+		return nil, errors.New("unable to generate random data")
+	}
+
+	return buffer, nil
+}
+
+// pbkdf2 derives a keyLength byte key from a password and salt as described in RFC 8018,
+// using HMAC-SHA256 as the pseudorandom function
+func pbkdf2(password, salt []byte, iterations, keyLength int) []byte {
+
+	prf := hmac.New(sha256.New, password)
+	hashLength := prf.Size()
+	numBlocks := (keyLength + hashLength - 1) / hashLength
+
+	var key []byte
+	counter := make([]byte, 4)
+
+	for block := 1; block <= numBlocks; block++ {
+
+		// U1 = PRF(password, salt || INT(block))
+		binary.BigEndian.PutUint32(counter, uint32(block))
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(counter)
+		u := prf.Sum(nil)
+
+		// T = U1 ^ U2 ^ ... ^ Uc
+		t := make([]byte, len(u))
+		copy(t, u)
+
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+
+		key = append(key, t...)
+	}
+
+	return key[:keyLength]
+}
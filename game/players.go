@@ -2,10 +2,13 @@ package game
 
 import (
 	"crypto/md5"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"io"
 	"math"
+	"strings"
+	"time"
 )
 
 
@@ -30,7 +33,9 @@ import (
 type Player struct {
 
 	Username string
-	Password string
+
+	// Salted hash of the Player's password, see HashPassword
+	PasswordHash string
 
 	// Pointer to Team this player is on
 	Team *Team
@@ -44,11 +49,40 @@ type Player struct {
 
 	PreviousTeam *Team
 
+	// When this Player last switched Teams
+	LastSwitch time.Time
+
+	// Number of Game Announcements this Player has been shown
+	AnnouncementsSeen int
+
+	// Number of Game Events the Player's furthest along Client has been sent or passed
+	// over, where a new Client starts. See UnseenEvents
+	EventsSeen int
+
+	// Remote address this Player last connected from
+	Address string
+
+	// Spectators watch without being on a Team
+	Spectator bool
+
+	// Set for bot Players run by the server, see AddBot
+	Bot *Bot
+
+	// When this Player last sent a command, see Presence
+	LastActive time.Time
+
+	// Registry Account this Player's stats are recorded to, nil if there is no Registry
+	Account *Account
+
 }
 
 // Team is a collection of Players working together on the same team
 type Team struct {
 
+	// Permanent Id players can use to pick the Team, it doesn't change
+	// when the Team is renamed or other Teams come and go
+	Id			int
+
 	Name 		string
 
 	Game *Game
@@ -70,18 +104,27 @@ type Team struct {
 
 	DeploymentPoints int
 
+	// If true new Players are only placed on this Team if they have an
+	// invite code, and other Players can't switch to it without one
+	InviteOnly bool
+
+	// Live invite codes and when they expire
+	InviteCodes map[string]time.Time
+
 }
 
 // GetSmallestTeam when called on a Game returns the Team in the game with
-// the least userse
+// the least userse. Invite only Teams are skipped, so nil is returned if every Team is
+// invite only. Departed Players aren't counted
 func (game *Game) GetSmallestTeam() *Team {
 
 	var smallestTeam *Team
 	smallestAmount := math.MaxInt32
 
 	for _, team := range game.Teams {
-		if team.NumPlayers < smallestAmount {
-			smallestAmount = team.NumPlayers
+		active := team.ActivePlayers()
+		if !team.InviteOnly && active < smallestAmount {
+			smallestAmount = active
 			smallestTeam = team
 		}
 	}
@@ -90,40 +133,257 @@ func (game *Game) GetSmallestTeam() *Team {
 
 }
 
+// QUEUE_TIMEOUT is how long a queued Player can go without retrying to join before
+// they lose their place in the waiting queue
+const QUEUE_TIMEOUT = 2 * time.Minute
+
+// Errors returned by Join when a Player is turned away
+var (
+	ErrServerPassword    = errors.New("incorrect server password")
+	ErrIncorrectPassword = errors.New("incorrect password")
+	ErrGameFull          = errors.New("game is full, try again later")
+	ErrNoOpenTeam        = errors.New("every team is invite only, join with a team code")
+)
+
+// JoinRequest holds everything a Player supplies when joining a Game
+type JoinRequest struct {
+	Username       string
+	Password       string
+	ServerPassword string
+
+	// Optional invite code for the Team the Player wants to join
+	TeamCode       string
+
+	// Remote address the Player is connecting from, checked against the BanList
+	Address        string
+
+	// If true the Player is only watching, see Spectate
+	Spectator      bool
+}
+
+// QueueEntry is a Player waiting for a spot to open up in a full Game
+type QueueEntry struct {
+	Username string
+
+	// Last time this Player tried to join, entries that go stale are dropped
+	LastSeen time.Time
+}
+
+// NumPlayers returns the number of Players across every Team in the Game
+func (game *Game) NumPlayers() int {
+	total := 0
+	for _, team := range game.Teams {
+		total += team.NumPlayers
+	}
+
+	return total
+}
+
 // Adds a new Player to a Game, returns pointer to new Player
-// This should be used to instantiate a new Player
-func (game *Game) Join (username, password string) (*Player, bool, error) {
+// This should be used to instantiate a new Player. Join runs every step of joining in
+// one go; servers that hold the Game lock should run CheckCredentials without it, see
+// Screen, PasswordOnFile and Place
+func (game *Game) Join (request JoinRequest) (*Player, bool, error) {
 
-	// Generate ID based on Username
-	id := RandomId(username, 32)
+	if err := game.Screen(request); err != nil {
+		return nil, false, err
+	}
 
-	// Check to see if that user is already registered in this Game
-	// If not register the user
-	player := game.GetPlayerById(id)
-	if player == nil {
+	onFile, registered := game.PasswordOnFile(request.Username)
+	credentials, err := CheckCredentials(request.Password, onFile, registered)
+	if err != nil {
+		return nil, registered, err
+	}
 
-		team := game.GetSmallestTeam()
+	return game.Place(request, credentials)
+}
 
-		// Create new player
-		newPlayer := Player{username, password, team, id, 0, 0, nil}
+// Screen turns away a Player before their password is looked at: anyone without the
+// server password, anyone banned, and spectators using the name of a Player
+func (game *Game) Screen(request JoinRequest) error {
 
-		// Add reference to player to Team.Players array
-		team.Players = append(team.Players, &newPlayer)
+	// The server password is required of everyone, new or returning
+	if game.Password != "" && subtle.ConstantTimeCompare([]byte(request.ServerPassword), []byte(game.Password)) != 1 {
+		return ErrServerPassword
+	}
 
-		// Increment number of Players on Team
-		team.NumPlayers += 1
+	// Keep banned Players out, by name or by address
+	if ban := game.Bans.Check(request.Username, request.Address); ban != nil {
+		return ban
+	}
 
-		return &newPlayer, false, nil
+	if request.Spectator && game.GetPlayerByUsername(request.Username) != nil {
+		return errors.New("that username is already playing in this game")
+	}
 
-	} else {
-		// If Player already exists check the password
-		if password == player.Password {
-			return player, true, nil
-		} else {
-			return nil, true, errors.New("incorrect password")
+	return nil
+}
+
+// Place puts a Player whose password has been checked into the Game, as a new or
+// returning Player or as a spectator. If the username's password changed hands since
+// the check, say because someone else registered it first, the Player is turned away
+func (game *Game) Place(request JoinRequest, credentials Credentials) (*Player, bool, error) {
+
+	// Anything could have changed while the password was being checked
+	if err := game.Screen(request); err != nil {
+		return nil, false, err
+	}
+
+	onFile, registered := game.PasswordOnFile(request.Username)
+	if registered != credentials.registered || (registered && onFile != credentials.hash) {
+		return nil, true, ErrIncorrectPassword
+	}
+
+	if request.Spectator {
+		return game.Spectate(request, credentials)
+	}
+
+	username := request.Username
+	hash := credentials.hash
+
+	// Returning Players pick up where they left off
+	if player := game.GetPlayerByUsername(username); player != nil {
+		player.Address = request.Address
+		player.Touch()
+		game.Registry.Seen(player.Account, false)
+		return player, true, nil
+	}
+
+	// Spectators can stop watching and join, but nobody else can take their name
+	spectator := game.GetSpectator(username)
+
+	team := game.GetSmallestTeam()
+
+	// An invite code puts the Player on the inviting Team, as long as that
+	// doesn't throw the Teams out of balance
+	if request.TeamCode != "" {
+		team = game.FindInvite(request.TeamCode)
+		if team == nil {
+			return nil, false, ErrInvalidInvite
 		}
+
+		if err := game.checkNewcomerBalance(team); err != nil {
+			return nil, false, err
+		}
+	}
+
+	// Without a code there has to be a Team that isn't invite only
+	if team == nil {
+		return nil, false, ErrNoOpenTeam
 	}
 
+	// Make sure there is room for another Player
+	if err := game.admit(username); err != nil {
+		return nil, false, err
+	}
+
+	// Player IDs are random so they can't be worked out from the username
+	id, err := NewPlayerId()
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Invite codes are single use
+	if request.TeamCode != "" {
+		delete(team.InviteCodes, strings.ToUpper(request.TeamCode))
+	}
+
+	if spectator != nil {
+		game.RemoveSpectator(spectator)
+	}
+
+	// First time this username has been used on this server
+	account := game.Registry.Get(username)
+	if account == nil {
+		account = game.Registry.Register(username, hash)
+	}
+	game.Registry.Seen(account, true)
+
+	game.Notify(team, EVENT_TEAM, "%v joined %v", username, team.Name)
+
+	// Create new player
+	newPlayer := Player{
+		Username:     username,
+		PasswordHash: hash,
+		Team:         team,
+		Id:           id,
+		Address:      request.Address,
+		Account:      account,
+
+		// Players only hear about what happens after they arrive
+		AnnouncementsSeen: len(game.Announcements),
+		EventsSeen:        game.EventCount(),
+
+		LastActive: time.Now(),
+	}
+
+	// Add reference to player to Team.Players array
+	team.Players = append(team.Players, &newPlayer)
+
+	// Increment number of Players on Team
+	team.NumPlayers += 1
+
+	if bot := game.stepAside(team); bot != nil {
+		game.Announce("%v stepped aside to make room for %v", bot.Username, username)
+	}
+
+	return &newPlayer, false, nil
+}
+
+// admit checks whether a new Player can take a spot in the Game. When the Game is full
+// the Player is either turned away or, if QueueWhenFull is set, given a place in the
+// waiting queue. Queued Players get the first open spots, in the order they queued
+func (game *Game) admit(username string) error {
+
+	// A MaxPlayers of 0 means there is no limit
+	if game.MaxPlayers == 0 {
+		return nil
+	}
+
+	// Bots give up their spots to humans
+	openSpots := int(game.MaxPlayers) - game.NumPlayers() + len(game.Bots())
+
+	if !game.QueueWhenFull {
+		if openSpots <= 0 {
+			return ErrGameFull
+		}
+		return nil
+	}
+
+	// Drop anyone who has stopped trying to join
+	var queue []*QueueEntry
+	for _, entry := range game.WaitQueue {
+		if time.Since(entry.LastSeen) < QUEUE_TIMEOUT {
+			queue = append(queue, entry)
+		}
+	}
+	game.WaitQueue = queue
+
+	// Find this Player's place in line, or put them at the back of it
+	position := -1
+	for i, entry := range game.WaitQueue {
+		if entry.Username == username {
+			position = i
+			entry.LastSeen = time.Now()
+		}
+	}
+
+	if position == -1 {
+		position = len(game.WaitQueue)
+		if openSpots > position {
+			return nil
+		}
+		game.WaitQueue = append(game.WaitQueue, &QueueEntry{username, time.Now()})
+	}
+
+	// Everyone ahead in the queue gets a spot first
+	if openSpots > position {
+		game.WaitQueue = append(game.WaitQueue[:position], game.WaitQueue[position+1:]...)
+		return nil
+	}
+
+	return fmt.Errorf("game is full, you are number %v in the waiting queue. Try joining again shortly",
+		position+1)
 }
 
 func RandomId(input string, length int) string {
@@ -138,20 +398,20 @@ func RandomId(input string, length int) string {
 // NewTeam Instantiates a new Team
 func (game *Game) NewTeam() *Team {
 
-
-
 	team := Team{
-	"",
-	game,
-	[]*Player{},
-	0,
-	make(map[*Team][]Coordinate),
-	make(map[*Team][]Coordinate),
-	[]Coordinate{},
-	[]*Ship{},
-	game.StartDeployPts,
+		Game:             game,
+		Players:          []*Player{},
+		Hits:             make(map[*Team][]Coordinate),
+		Misses:           make(map[*Team][]Coordinate),
+		ShotsUpon:        []Coordinate{},
+		Ships:            []*Ship{},
+		DeploymentPoints: game.StartDeployPts,
+		InviteCodes:      make(map[string]time.Time),
 	}
 
+	game.lastTeamId++
+	team.Id = game.lastTeamId
+
 	teamId := fmt.Sprintf("%p", &team)
 	team.Name = fmt.Sprintf("Fleet-%v", RandomId(teamId, 5))
 
@@ -182,14 +442,32 @@ func (game *Game) GetPlayerById(id string) *Player {
 	return result
 }
 
-// TopPlayer finds a returns the player on a team with the most points (the leader)
+// GetPlayerByUsername finds and returns a Player using their username
+func (game *Game) GetPlayerByUsername(username string) *Player {
+
+	for _, team := range game.Teams {
+		for _, player := range team.Players {
+			if player.Username == username {
+				return player
+			}
+		}
+	}
+
+	return nil
+}
+
+// TopPlayer finds a returns the player on a team with the most points (the leader).
+// Bots only lead Teams that have no humans on them
 func (team *Team) TopPlayer() *Player {
 	topPlayer := team.Players[0]
 	topPlyrPt := team.Players[0].Points
 
 
 	for _, player := range team.Players {
-		if player.Points > topPlyrPt {
+		if player.Bot != nil && topPlayer.Bot == nil {
+			continue
+		}
+		if (player.Bot == nil && topPlayer.Bot != nil) || player.Points > topPlyrPt {
 			topPlayer = player
 			topPlyrPt = topPlayer.Points
 		}
@@ -198,12 +476,87 @@ func (team *Team) TopPlayer() *Player {
 	return topPlayer
 }
 
+// CanSwitch checks whether a Player is allowed to move to destTeam, enforcing the
+// Game's switch cooldown and its maximum Team imbalance. Returns nil if the switch
+// is allowed
+func (game *Game) CanSwitch(player *Player, destTeam *Team) error {
+	return game.canSwitch(player, destTeam, false)
+}
+
+// canSwitch is CanSwitch for Players who may have been invited to destTeam
+func (game *Game) canSwitch(player *Player, destTeam *Team, invited bool) error {
+
+	if destTeam == player.Team {
+		return errors.New("you are already on that team")
+	}
+
+	if destTeam.InviteOnly && !invited {
+		return errors.New("that team is invite only, you need an invite code from its leader")
+	}
+
+	// Make sure the Player has waited long enough since their last switch
+	if !player.LastSwitch.IsZero() {
+		wait := game.SwitchCooldown - time.Since(player.LastSwitch)
+		if wait > 0 {
+			return fmt.Errorf("you must wait %v before switching teams again", wait.Round(time.Second))
+		}
+	}
+
+	// Make sure the switch won't leave the Teams more unbalanced than 1:MaxImbalance.
+	// A MaxImbalance of 0 means there is no limit. Departed Players aren't counted
+	if game.MaxImbalance != 0 {
+		destCount := destTeam.ActivePlayers() + 1
+		originCount := player.Team.ActivePlayers() - 1
+		if originCount < 1 {
+			originCount = 1
+		}
+
+		if destCount > int(game.MaxImbalance) * originCount {
+			return fmt.Errorf("switching would unbalance the teams beyond 1:%v", game.MaxImbalance)
+		}
+	}
+
+	return nil
+}
+
+// ChangeTeam moves a Player to destTeam if the Game rules allow it, charging them
+// SWITCH_COST points and resetting their hit streak
+func (game *Game) ChangeTeam(player *Player, destTeam *Team) error {
+	return game.changeTeam(player, destTeam, false)
+}
+
+// changeTeam is ChangeTeam for Players who may have been invited to destTeam
+func (game *Game) changeTeam(player *Player, destTeam *Team, invited bool) error {
+
+	if err := game.canSwitch(player, destTeam, invited); err != nil {
+		return err
+	}
+
+	originalTeam := player.Team
+	SwitchTeam(player, destTeam)
+
+	game.Notify(originalTeam, EVENT_TEAM, "%v left for %v", player.Username, destTeam.Name)
+	game.Notify(destTeam, EVENT_TEAM, "%v joined from %v", player.Username, originalTeam.Name)
+
+	player.LastSwitch = time.Now()
+	player.HitStreak = 0
+	player.Points -= SWITCH_COST
+	if player.Points < 0 {
+		player.Points = 0
+	}
+
+	return nil
+}
+
 // SwitchTeam switches a Players Team
 func SwitchTeam(player *Player, destTeam *Team) {
 
 	// Get the Players original Team
 	originalTeam := player.Team
 
+	// Remember where the Player came from
+	player.PreviousTeam = originalTeam
+
 	// Find the index in the Team.Players array of the Player
 	playerIndex := originalTeam.findPlayerIndex(player)
 
@@ -225,6 +578,22 @@ func SwitchTeam(player *Player, destTeam *Team) {
 
 }
 
+// RemovePlayer takes a Player out of the Game entirely, removing them from their Team
+func (game *Game) RemovePlayer(player *Player) {
+
+	team := player.Team
+
+	playerIndex := team.findPlayerIndex(player)
+	if playerIndex == -1 {
+		return
+	}
+
+	team.Players = append(team.Players[:playerIndex], team.Players[playerIndex+1:]...)
+	team.NumPlayers--
+
+	game.Notify(team, EVENT_TEAM, "%v left the game", player.Username)
+}
+
 // findPlayerIndex finds the index of Player in a Teams Player array
 func (team Team) findPlayerIndex(player *Player) int {
 	playerList := team.Players
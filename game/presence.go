@@ -0,0 +1,92 @@
+package game
+
+import (
+	"time"
+)
+
+/*********************************************************
+ *														 *
+ *                   	  Warships						 *
+ *					   Jason Meredith					 *
+ *														 *
+ *	DATE:		October 18, 2026						 *
+ *	FILE: 		presence.go								 *
+ *	PURPOSE:	Tracks when each Player was last active	 *
+ *				so Players who have wandered off can be	 *
+ *				shown as AFK, and Players who have left	 *
+ *				for good don't count when balancing		 *
+ *				Teams.									 *
+ *				 										 *
+ *														 *
+ *********************************************************/
+
+// Default idle times before a Player is shown as AFK or departed
+const (
+	DEFAULT_AFK_TIMEOUT      = 5 * time.Minute
+	DEFAULT_DEPARTED_TIMEOUT = 30 * time.Minute
+)
+
+// Presence is integer used to represent the Presence enum options. Represents whether
+// a Player is still around
+type Presence uint8
+
+// Presence is ONLINE for active Players, AFK for Players who have been idle for the Game's
+// AfkTimeout and DEPARTED for Players idle for the DepartedTimeout or who logged out
+const (
+	ONLINE Presence = iota
+	AFK
+	DEPARTED
+)
+
+var presenceNames = []string{"online", "afk", "departed"}
+
+// String returns the name of the Presence
+func (presence Presence) String() string {
+	if int(presence) < len(presenceNames) {
+		return presenceNames[presence]
+	}
+	return "unknown"
+}
+
+// Touch records that the Player is active right now
+func (player *Player) Touch() {
+	player.LastActive = time.Now()
+}
+
+// Depart marks the Player as departed straight away, used when they log out
+func (player *Player) Depart() {
+	player.LastActive = time.Time{}
+}
+
+// Presence works out whether a Player is online, AFK or departed. A timeout of 0 means
+// Players are never marked that way. Bots never leave
+func (game *Game) Presence(player *Player) Presence {
+
+	if player.Bot != nil {
+		return ONLINE
+	}
+
+	idle := time.Since(player.LastActive)
+
+	if player.LastActive.IsZero() || (game.DepartedTimeout != 0 && idle >= game.DepartedTimeout) {
+		return DEPARTED
+	}
+
+	if game.AfkTimeout != 0 && idle >= game.AfkTimeout {
+		return AFK
+	}
+
+	return ONLINE
+}
+
+// ActivePlayers returns the number of Players on the Team who haven't departed
+func (team *Team) ActivePlayers() int {
+	total := 0
+	for _, player := range team.Players {
+		if team.Game.Presence(player) != DEPARTED {
+			total++
+		}
+	}
+
+	return total
+}
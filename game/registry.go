@@ -0,0 +1,259 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"time"
+)
+
+/*********************************************************
+ *														 *
+ *                   	  Warships						 *
+ *					   Jason Meredith					 *
+ *														 *
+ *	DATE:		October 18, 2026						 *
+ *	FILE: 		registry.go								 *
+ *	PURPOSE:	The player registry. Accounts hold each	 *
+ *				username's password hash, rating and	 *
+ *				lifetime stats, and are saved to a file	 *
+ *				so Players keep their identity across	 *
+ *				every Game hosted from the same server.	 *
+ *				 										 *
+ *														 *
+ *********************************************************/
+
+const (
+	// DEFAULT_REGISTRY_FILE is where accounts are saved unless the server says otherwise
+	DEFAULT_REGISTRY_FILE = "warships-players.json"
+
+	// START_RATING is the rating every new account starts with
+	START_RATING = 1000
+
+	// RATING_K is the most a rating can move from a single sinking
+	RATING_K = 32
+)
+
+// PlayerStats are an account's totals across every Game it has played
+type PlayerStats struct {
+	GamesPlayed		int
+	ShotsFired		int
+	Hits			int
+	Sinks			int
+	PointsEarned	int
+}
+
+// Account is a registered username
+type Account struct {
+	Username		string
+
+	// Salted hash of the account's password, see HashPassword
+	PasswordHash	string
+
+	Rating			int
+	Stats			PlayerStats
+
+	Created			time.Time
+	LastSeen		time.Time
+}
+
+// Registry is every Account on the server along with the file it is saved to
+type Registry struct {
+	Path		string
+	Accounts	map[string]*Account
+
+	// Set when an Account has changed since the Registry was last saved
+	changed		bool
+}
+
+// LoadRegistry reads a Registry from a file. If the file doesn't exist yet an empty
+// Registry is returned that will be saved there
+func LoadRegistry(path string) (*Registry, error) {
+
+	registry := &Registry{Path: path, Accounts: make(map[string]*Account)}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return registry, nil
+	}
+	if err != nil {
+		return registry, err
+	}
+
+	if err := json.Unmarshal(data, &registry.Accounts); err != nil {
+		return registry, errors.New("player registry file is corrupt: " + path)
+	}
+
+	if registry.Accounts == nil {
+		registry.Accounts = make(map[string]*Account)
+	}
+
+	return registry, nil
+}
+
+// Save writes the Registry to its file if any Account has changed since it was last saved
+func (registry *Registry) Save() error {
+
+	if registry == nil || registry.Path == "" || !registry.changed {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(registry.Accounts, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(registry.Path, data, 0600); err != nil {
+		return err
+	}
+
+	registry.changed = false
+
+	return nil
+}
+
+// Get returns the Account for a username, or nil if it isn't registered
+func (registry *Registry) Get(username string) *Account {
+	if registry == nil {
+		return nil
+	}
+
+	return registry.Accounts[username]
+}
+
+// Register creates an Account for a username with an already hashed password
+func (registry *Registry) Register(username, passwordHash string) *Account {
+
+	if registry == nil {
+		return nil
+	}
+
+	account := &Account{
+		Username:     username,
+		PasswordHash: passwordHash,
+		Rating:       START_RATING,
+		Created:      time.Now(),
+		LastSeen:     time.Now(),
+	}
+
+	registry.Accounts[username] = account
+	registry.changed = true
+
+	return account
+}
+
+// Seen records that an Account has just logged in, counting a new Game if it is one
+func (registry *Registry) Seen(account *Account, newGame bool) {
+
+	if registry == nil || account == nil {
+		return
+	}
+
+	account.LastSeen = time.Now()
+	if newGame {
+		account.Stats.GamesPlayed++
+	}
+
+	registry.changed = true
+}
+
+// RecordShot adds a shot to the shooter's stats. Sinking a Ship moves ratings: the
+// shooter gains more for sinking a higher rated Team, and the registered Players on
+// the sunk Team share the loss
+func (registry *Registry) RecordShot(player *Player, targetTeam *Team, result ShotResult, points int) {
+
+	if registry == nil || player.Account == nil {
+		return
+	}
+
+	account := player.Account
+	account.Stats.ShotsFired++
+	account.Stats.PointsEarned += points
+
+	if result == HIT || result == SINK {
+		account.Stats.Hits++
+	}
+
+	registry.changed = true
+
+	if result != SINK {
+		return
+	}
+
+	account.Stats.Sinks++
+
+	var losers []*Account
+	total := 0
+	for _, loser := range targetTeam.Players {
+		if loser.Account != nil {
+			losers = append(losers, loser.Account)
+			total += loser.Account.Rating
+		}
+	}
+
+	if len(losers) == 0 {
+		return
+	}
+
+	// Elo style: the less likely the sinking, the bigger the change
+	opponent := float64(total) / float64(len(losers))
+	expected := 1 / (1 + math.Pow(10, (opponent-float64(account.Rating))/400))
+	change := int(math.Round(RATING_K * (1 - expected)))
+
+	account.Rating += change
+	for _, loser := range losers {
+		loser.Rating -= int(math.Round(float64(change) / float64(len(losers))))
+	}
+}
+
+// Credentials is a joining Player's password, checked against the hash on file for
+// their username or hashed for a new one. See CheckCredentials
+type Credentials struct {
+	// True if the username had a password on file when it was checked
+	registered	bool
+
+	// Password hash the Player should use
+	hash		string
+}
+
+// PasswordOnFile returns the password hash a joining Player has to match: that of the
+// Player or spectator using the username, or of its Account. The bool is false if the
+// username is new to this server
+func (game *Game) PasswordOnFile(username string) (string, bool) {
+
+	if player := game.GetPlayerByUsername(username); player != nil {
+		return player.PasswordHash, true
+	}
+
+	if spectator := game.GetSpectator(username); spectator != nil {
+		return spectator.PasswordHash, true
+	}
+
+	if account := game.Registry.Get(username); account != nil {
+		return account.PasswordHash, true
+	}
+
+	return "", false
+}
+
+// CheckCredentials checks a password against the hash on file for a registered username,
+// or hashes it for a new one. Hashing is slow on purpose and touches no Game state, so
+// servers run it without holding the Game lock
+func CheckCredentials(password, onFile string, registered bool) (Credentials, error) {
+
+	if registered {
+		if !CheckPassword(password, onFile) {
+			return Credentials{}, ErrIncorrectPassword
+		}
+		return Credentials{registered: true, hash: onFile}, nil
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	return Credentials{hash: hash}, nil
+}
@@ -0,0 +1,163 @@
+package game
+
+import (
+	"time"
+)
+
+/*********************************************************
+ *														 *
+ *                   	  Warships						 *
+ *					   Jason Meredith					 *
+ *														 *
+ *	DATE:		October 18, 2026						 *
+ *	FILE: 		spectators.go							 *
+ *	PURPOSE:	Spectators watch the Game without being	 *
+ *				on a Team. Every shot is logged so what	 *
+ *				spectators see can be held back by the	 *
+ *				spectator delay, keeping them from		 *
+ *				passing live positions to Players.		 *
+ *				 										 *
+ *														 *
+ *********************************************************/
+
+// ShotRecord is a single shot fired by one Team upon another
+type ShotRecord struct {
+	Time		time.Time
+	From		*Team
+	To			*Team
+	Coordinate	Coordinate
+	Result		ShotResult
+}
+
+// Spectate logs a spectator into the Game once their password has been checked, see
+// Place. Spectators aren't placed on a Team and don't take up one of the Game's
+// MaxPlayers spots
+func (game *Game) Spectate(request JoinRequest, credentials Credentials) (*Player, bool, error) {
+
+	// Returning spectators pick up where they left off
+	if spectator := game.GetSpectator(request.Username); spectator != nil {
+		spectator.Address = request.Address
+		spectator.Touch()
+		return spectator, true, nil
+	}
+
+	id, err := NewPlayerId()
+	if err != nil {
+		return nil, false, err
+	}
+
+	account := game.Registry.Get(request.Username)
+	if account == nil {
+		account = game.Registry.Register(request.Username, credentials.hash)
+	}
+	game.Registry.Seen(account, false)
+
+	spectator := &Player{
+		Username:          request.Username,
+		PasswordHash:      credentials.hash,
+		Id:                id,
+		Address:           request.Address,
+		Spectator:         true,
+		AnnouncementsSeen: len(game.Announcements),
+		EventsSeen:        game.EventCount(),
+		LastActive:        time.Now(),
+		Account:           account,
+	}
+
+	game.Spectators = append(game.Spectators, spectator)
+
+	return spectator, false, nil
+}
+
+// GetSpectator finds and returns a spectator using their username
+func (game *Game) GetSpectator(username string) *Player {
+	for _, spectator := range game.Spectators {
+		if spectator.Username == username {
+			return spectator
+		}
+	}
+
+	return nil
+}
+
+// RemoveSpectator takes a spectator out of the Game
+func (game *Game) RemoveSpectator(spectator *Player) {
+	for i, existing := range game.Spectators {
+		if existing == spectator {
+			game.Spectators = append(game.Spectators[:i], game.Spectators[i+1:]...)
+			return
+		}
+	}
+}
+
+// SpectatorCutoff is the point in time spectators can currently see up to
+func (game *Game) SpectatorCutoff() time.Time {
+	return time.Now().Add(-game.SpectatorDelay)
+}
+
+// GetMapAt returns a Team's map as it was at the cutoff time, built from the shot log
+func (game *Game) GetMapAt(team *Team, cutoff time.Time) [][]CellState {
+
+	board := game.emptyBoard()
+
+	// Add in shots upon the team, remembering where ships were hit
+	damaged := make(map[Coordinate]bool)
+	for _, shot := range game.ShotLog {
+		if shot.To != team || shot.Time.After(cutoff) {
+			continue
+		}
+
+		board[shot.Coordinate.X][shot.Coordinate.Y] = CELL_MISS
+		if shot.Result != MISS {
+			damaged[shot.Coordinate] = true
+		}
+	}
+
+	// Add in ships that had been deployed by then
+	for _, ship := range team.Ships {
+		if ship.Deployed.After(cutoff) {
+			continue
+		}
+
+		for _, coord := range ship.GetOccupyingSpaces() {
+			if damaged[coord] {
+				board[coord.X][coord.Y] = CELL_DAMAGED
+			} else {
+				board[coord.X][coord.Y] = CELL_SHIP
+			}
+		}
+	}
+
+	return board
+}
+
+// GetRadarAt returns the shots a Team had fired on targetTeam as of the cutoff time
+func (game *Game) GetRadarAt(team *Team, targetTeam *Team, cutoff time.Time) [][]CellState {
+
+	board := game.emptyBoard()
+
+	for _, shot := range game.ShotLog {
+		if shot.From != team || shot.To != targetTeam || shot.Time.After(cutoff) {
+			continue
+		}
+
+		if shot.Result == MISS {
+			board[shot.Coordinate.X][shot.Coordinate.Y] = CELL_MISS
+		} else {
+			board[shot.Coordinate.X][shot.Coordinate.Y] = CELL_HIT
+		}
+	}
+
+	return board
+}
+
+// emptyBoard creates a board of squares with nothing known about them
+func (game *Game) emptyBoard() [][]CellState {
+
+	board := make([][]CellState, game.BoardSize)
+	for x := range board {
+		board[x] = make([]CellState, game.BoardSize)
+	}
+
+	return board
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/jason-meredith/warships/game"
 	"github.com/jason-meredith/warships/net"
+	"net/rpc"
 	"os"
 	"strconv"
 	"strings"
@@ -31,14 +32,22 @@ var logo = `
  *				 										 *
  *				The main function loads you into a 		 *
  *				menu giving you the option of Start 	 *
- *				Game, Join Game or Quit.				 *
+ *				Game, Join Game, Spectate Game or		 *
+ *				Quit.									 *
  *														 *
  *				Selecting Start Game will launch an		 *
  *				options menu allowing you to set up		 *
  *				preferences for the new Game Server.	 *
  *														 *
- *				Join Game will prompt you to enter		 *
- *				server IP Address, Username and Password *
+ *				Join Game will list the games running	 *
+ *				on the local network to choose from, or	 *
+ *				prompt you to enter server IP Address,	 *
+ *				and then Username and Password			 *
+ *				as well as the server password if the	 *
+ *				server has one							 *
+ *														 *
+ *				Spectate Game is the same as Join Game	 *
+ *				except you watch instead of playing		 *
  *														 *
  *				Quit will exit the program				 *
  *														 *
@@ -60,9 +69,10 @@ func main() {
 		fmt.Println("\t\t ~ By Jason Meredith ~ ")
 		fmt.Println()
 
-		inputMenu("Select an option\n1. Start Game\n2. Join Game\n3. Quit",
+		inputMenu("Select an option\n1. Start Game\n2. Join Game\n3. Spectate Game\n4. Quit",
 			func() { startServer() },
-			func() { joinGame() },
+			func() { joinGame(false) },
+			func() { joinGame(true) },
 			func() { os.Exit(0) })
 	}
 
@@ -79,25 +89,57 @@ func getArgs() map[string]*string {
 	args["mode"] = flag.String("mode", "client", "Starting a game or joining a game [ client | server ]")
 
 	// Join flags
-	args["joinAddress"] = flag.String("address", "127.0.0.1", "Server address to connect to")
+	args["joinAddress"] = flag.String("address", "127.0.0.1", "Server address to connect to, as host or host:port")
+	args["port"] = flag.String("port", strconv.Itoa(net.RPC_PORT), "Port the server listens on, or the client connects to if the address has no port")
 	args["joinUsername"] = flag.String("username", "player", "Player username")
 	args["password"] = flag.String("password", "", "Player password")
+	args["serverPassword"] = flag.String("server-password", "", "Password required to join the server")
+	args["teamCode"] = flag.String("team-code", "", "Invite code for the team you want to join")
 
 	args["hostAdminPassword"] = flag.String("admin-password", "", "Admin password")
+	args["hostName"] = flag.String("name", "", "Server name shown to players on the local network (defaults to the hostname)")
 
-	args["hostMaxPlayers"] = flag.String("max-players", "32", "Max players")
+	args["hostSpectatorDelay"] = flag.String("spectator-delay", "30s", "How far behind the game spectators see")
+	args["hostBanFile"] = flag.String("ban-file", game.DEFAULT_BAN_FILE, "File the ban list is saved to")
+	args["hostRegistryFile"] = flag.String("registry-file", game.DEFAULT_REGISTRY_FILE, "File player accounts are saved to")
+	args["hostChatLog"] = flag.String("chat-log", net.DEFAULT_CHAT_LOG, "File chat messages are logged to (empty to not log chat)")
+	args["hostMaxPlayers"] = flag.String("max-players", "32", "Max players (0 for no limit)")
 	args["hostShipLimit"] = flag.String("ship-limit", "16", "Ship limit")
 	args["hostBoardSize"] = flag.String("board-size", "16", "Board size")
 	args["deployPts"] = flag.String("deploy-points", "10", "Starting deployment points")
-
+	args["hostMaxImbalance"] = flag.String("max-imbalance", "2", "Max team imbalance ratio 1:X a player can switch into (0 for no limit)")
+	args["hostSwitchCooldown"] = flag.String("switch-cooldown", "1m", "How long players must wait between team switches")
+	args["hostAllianceCooldown"] = flag.String("alliance-cooldown", "5m", "How long an alliance must last before it can be broken")
+	args["hostSessionTimeout"] = flag.String("session-timeout", "30m", "How long a player session lasts without activity")
+	args["hostAfkTimeout"] = flag.String("afk-timeout", "5m", "How long a player can be idle before they are shown as AFK (0 to never)")
+	args["hostDepartedTimeout"] = flag.String("departed-timeout", "30m", "How long a player can be idle before they no longer count towards team balance (0 to never)")
+	args["hostCertFile"] = flag.String("tls-cert", net.DEFAULT_CERT_FILE, "Certificate file for TLS, a self-signed one is generated if neither it nor the key file exists")
+	args["hostKeyFile"] = flag.String("tls-key", net.DEFAULT_KEY_FILE, "Private key file for the TLS certificate")
+	args["knownServers"] = flag.String("known-servers", net.DEFAULT_KNOWN_SERVERS_FILE, "File the certificates of servers connected to over TLS are pinned in")
+
+	spectate := flag.Bool("spectate", false, "Join as a spectator instead of a player")
+	shareAllyRadar := flag.Bool("share-ally-radar", false, "Let allied teams see each other's shots on their radar")
+	queueWhenFull := flag.Bool("queue", false, "Queue players when the server is full instead of turning them away")
 	commandMode := flag.Bool("cmd", false, "Run in single command mode")
+	useTLS := flag.Bool("tls", false, "Encrypt traffic between the client and server with TLS")
+	lanDiscovery := flag.Bool("lan", true, "Announce the server on the local network so players can find it")
 
 	flag.Parse()
 
 	msg := strings.Join(flag.Args(), " ")
 	cmd := strconv.FormatBool(*commandMode)
+	queue := strconv.FormatBool(*queueWhenFull)
+	shareRadar := strconv.FormatBool(*shareAllyRadar)
+	spectating := strconv.FormatBool(*spectate)
+	secure := strconv.FormatBool(*useTLS)
+	lan := strconv.FormatBool(*lanDiscovery)
 	args["msg"] = &msg
 	args["command"] = &cmd
+	args["hostQueue"] = &queue
+	args["hostShareAllyRadar"] = &shareRadar
+	args["spectate"] = &spectating
+	args["tls"] = &secure
+	args["hostLANDiscovery"] = &lan
 
 	return args
 }
@@ -112,36 +154,84 @@ func nonInteractiveStartup(args map[string]*string) {
 		shipLimit, _ := strconv.Atoi(*args["hostShipLimit"])
 		boardSize, _ := strconv.Atoi(*args["hostBoardSize"])
 		deployPts, _ := strconv.Atoi(*args["deployPts"])
+		maxImbalance, _ := strconv.Atoi(*args["hostMaxImbalance"])
+		switchCooldown, _ := time.ParseDuration(*args["hostSwitchCooldown"])
+		sessionTimeout, _ := time.ParseDuration(*args["hostSessionTimeout"])
+		allianceCooldown, _ := time.ParseDuration(*args["hostAllianceCooldown"])
+		spectatorDelay, _ := time.ParseDuration(*args["hostSpectatorDelay"])
+		afkTimeout, _ := time.ParseDuration(*args["hostAfkTimeout"])
+		departedTimeout, _ := time.ParseDuration(*args["hostDepartedTimeout"])
+
+		port, err := net.ParsePort(*args["port"])
+		if err != nil {
+			fmt.Println("Error: " + err.Error())
+			os.Exit(1)
+		}
 
 		newGame := game.Game{}
 		newGame.Live = true
-		newGame.Port = net.RPC_PORT
-		newGame.Password = *args["password"]
+		newGame.Name = *args["hostName"]
+		newGame.Port = port
+		newGame.Password = *args["serverPassword"]
 		newGame.StartTime = time.Now()
 		newGame.AdminPassword = *args["hostAdminPassword"]
+		newGame.BanFile = *args["hostBanFile"]
+		newGame.RegistryFile = *args["hostRegistryFile"]
+		newGame.ChatLogFile = *args["hostChatLog"]
 		newGame.MaxPlayers = uint8(maxPlayers)
+		newGame.QueueWhenFull = *args["hostQueue"] == "true"
 		newGame.ShipLimit = uint8(shipLimit)
 		newGame.BoardSize = uint8(boardSize)
 		newGame.Teams = []*game.Team{}
 		newGame.StartDeployPts = deployPts
+		newGame.MaxImbalance = uint8(maxImbalance)
+		newGame.SwitchCooldown = switchCooldown
+		newGame.SessionTimeout = sessionTimeout
+		newGame.AfkTimeout = afkTimeout
+		newGame.DepartedTimeout = departedTimeout
+		newGame.AllianceCooldown = allianceCooldown
+		newGame.ShareAllyRadar = *args["hostShareAllyRadar"] == "true"
+		newGame.SpectatorDelay = spectatorDelay
+		newGame.TLS = *args["tls"] == "true"
+		newGame.CertFile = *args["hostCertFile"]
+		newGame.KeyFile = *args["hostKeyFile"]
+		newGame.LANDiscovery = *args["hostLANDiscovery"] == "true"
 
 		net.StartGameServer(&newGame)
 
 		// Run in client mode, connecting to an existing game
 	} else if *args["mode"] == "client" {
-		playerId, connection, err := net.CreateServerConnection(
-			*args["joinUsername"],
-			*args["password"],
-			*args["joinAddress"])
+		port, err := net.ParsePort(*args["port"])
+		if err != nil {
+			fmt.Println("Error: " + err.Error())
+			os.Exit(1)
+		}
+
+		var known *net.KnownServers
+		if *args["tls"] == "true" {
+			known, err = net.LoadKnownServers(*args["knownServers"])
+			if err != nil {
+				fmt.Println("Error: " + err.Error())
+				os.Exit(1)
+			}
+		}
+
+		token, connection, err := connect(net.LoginCredentials{
+			Username:       *args["joinUsername"],
+			Password:       *args["password"],
+			ServerPassword: *args["serverPassword"],
+			TeamCode:       *args["teamCode"],
+			Spectator:      *args["spectate"] == "true",
+		}, net.ServerAddress(*args["joinAddress"], port), known)
 
 		if err == nil {
 			// If the -cmd flag is present, we take any remaining args after the officials ones
 			// and run it like a player command. Otherwise simple join the game and continue
 			// normally
 			if *args["command"] == "true" {
-				net.SendCommand(playerId, connection, *args["msg"])
+				net.SendCommand(token, connection, *args["msg"])
 			} else {
-				net.AcceptCommands(playerId, connection)
+				net.AcceptCommands(token, connection)
 			}
 		} else {
 			fmt.Println("Error: " + err.Error())
@@ -154,45 +244,76 @@ func nonInteractiveStartup(args map[string]*string) {
 // startServer shows the menu screen for starting a new server
 func startServer() {
 
-	const PASSWRD = "Password"
+	const NAME = "Server Name (blank for hostname)"
+	const PASSWRD = "Server Password"
 	const ADMIN_PASSWRD = "Admin Password"
 	const MAX_PLAYERS = "Max Players"
 	const SHIP_LIMIT = "Ship Limit"
 	const BOARD_SIZE = "Board Size"
 	const DEPLOY_POINTS = "Deployment Points"
+	const MAX_IMBALANCE = "Max Imbalance (1:X)"
+	const PORT = "Port (blank for default)"
+	const TLS = "Use TLS (y/n)"
 
 	setupScreen()
 
 	options := inputOptions(
 		"Start New Game",
+		NAME,
 		MAX_PLAYERS,
 		BOARD_SIZE,
 		SHIP_LIMIT,
 		PASSWRD,
 		ADMIN_PASSWRD,
 		DEPLOY_POINTS,
+		MAX_IMBALANCE,
+		PORT,
+		TLS,
 	)
 
 	maxPlayers, err := strconv.Atoi(options[MAX_PLAYERS])
 	shipLimit, err := strconv.Atoi(options[SHIP_LIMIT])
 	boardSize, err := strconv.Atoi(options[BOARD_SIZE])
 	deployPts, err := strconv.Atoi(options[DEPLOY_POINTS])
+	maxImbalance, err := strconv.Atoi(options[MAX_IMBALANCE])
 
 	if err != nil {
 		// TODO: Handle this error pls
 	}
 
+	port, err := net.ParsePort(options[PORT])
+	if err != nil {
+		fmt.Println("Error: " + err.Error())
+		fmt.Printf("Using the default port %v\n", net.RPC_PORT)
+		port = net.RPC_PORT
+	}
+
 	newGame := game.Game{}
 	newGame.Live = true
-	newGame.Port = net.RPC_PORT
+	newGame.Name = options[NAME]
+	newGame.Port = port
 	newGame.Password = options[PASSWRD]
 	newGame.StartTime = time.Now()
 	newGame.AdminPassword = options[ADMIN_PASSWRD]
+	newGame.BanFile = game.DEFAULT_BAN_FILE
+	newGame.RegistryFile = game.DEFAULT_REGISTRY_FILE
+	newGame.ChatLogFile = net.DEFAULT_CHAT_LOG
 	newGame.MaxPlayers = uint8(maxPlayers)
 	newGame.ShipLimit = uint8(shipLimit)
 	newGame.BoardSize = uint8(boardSize)
 	newGame.Teams = []*game.Team{}
 	newGame.StartDeployPts = deployPts
+	newGame.MaxImbalance = uint8(maxImbalance)
+	newGame.SwitchCooldown = time.Minute
+	newGame.SessionTimeout = net.DEFAULT_SESSION_TIMEOUT
+	newGame.AfkTimeout = game.DEFAULT_AFK_TIMEOUT
+	newGame.DepartedTimeout = game.DEFAULT_DEPARTED_TIMEOUT
+	newGame.AllianceCooldown = 5 * time.Minute
+	newGame.SpectatorDelay = 30 * time.Second
+	newGame.TLS = yes(options[TLS])
+	newGame.CertFile = net.DEFAULT_CERT_FILE
+	newGame.KeyFile = net.DEFAULT_KEY_FILE
+	newGame.LANDiscovery = true
 
 	clearScreen()
 	net.StartGameServer(&newGame)
@@ -200,32 +321,71 @@ func startServer() {
 	// Proceed to game
 }
 
-// joinGame shows the menu screen for joining a running game server
-func joinGame() {
+// joinGame shows the menu screen for joining a running game server, either as a
+// player or as a spectator
+func joinGame(spectate bool) {
 
-	const SERV_ADDR = "Server Address"
+	const SERV_ADDR = "Server Address (host:port)"
+	const SERV_PASSWRD = "Server Password"
 	const PASSWRD = "Password"
 	const USERNAME = "Username"
+	const TEAM_CODE = "Team Code (optional)"
+	const TLS = "Use TLS (y/n)"
+
+	// Spectators aren't joining a Team so they don't need a team code
+	title := "Joining Game"
+	prompts := []string{SERV_ADDR, TLS, SERV_PASSWRD, PASSWRD, USERNAME}
+	if spectate {
+		title = "Spectating Game"
+	} else {
+		prompts = append(prompts, TEAM_CODE)
+	}
 
 	setupScreen()
 
+	// A Game picked from the local network already says where it is, whether it uses TLS
+	// and whether it has a server password
+	chosen := chooseServer()
+	if chosen != nil {
+		prompts = prompts[2:]
+		if !chosen.Password {
+			prompts = prompts[1:]
+		}
+		setupScreen()
+	}
+
 	success := false
 
 	for !success {
-		options := inputOptions(
-			"Joining Game",
-			SERV_ADDR,
-			PASSWRD,
-			USERNAME,
-		)
-
-		playerId, connection, err := net.CreateServerConnection(
-			strings.TrimRight(options[USERNAME], "\n"),
-			strings.TrimRight(options[PASSWRD], "\n"),
-			options[SERV_ADDR])
+		options := inputOptions(title, prompts...)
+
+		address := options[SERV_ADDR]
+		secure := yes(options[TLS])
+		if chosen != nil {
+			address = chosen.Address
+			secure = chosen.TLS
+		}
+
+		var known *net.KnownServers
+		var err error
+		if secure {
+			known, err = net.LoadKnownServers(net.DEFAULT_KNOWN_SERVERS_FILE)
+		}
+
+		var token string
+		var connection *rpc.Client
+		if err == nil {
+			token, connection, err = connect(net.LoginCredentials{
+				Username:       strings.TrimRight(options[USERNAME], "\n"),
+				Password:       strings.TrimRight(options[PASSWRD], "\n"),
+				ServerPassword: options[SERV_PASSWRD],
+				TeamCode:       options[TEAM_CODE],
+				Spectator:      spectate,
+			}, address, known)
+		}
 		if err == nil {
 			success = true
-			net.AcceptCommands(playerId, connection)
+			net.AcceptCommands(token, connection)
 		} else {
 			fmt.Println("Error: " + err.Error())
 			time.Sleep(700 * time.Millisecond)
@@ -234,3 +394,46 @@ func joinGame() {
 	}
 
 }
+
+// chooseServer lists the Games announcing themselves on the local network and lets the user
+// pick one. Returns nil if none were found or the user would rather enter an address
+func chooseServer() *net.ServerAnnouncement {
+
+	fmt.Println("Searching for games on the local network...")
+
+	servers, err := net.DiscoverServers(net.DISCOVERY_TIMEOUT)
+	if err != nil || len(servers) == 0 {
+		return nil
+	}
+
+	var chosen *net.ServerAnnouncement
+
+	prompt := "Select a game"
+	var options []MenuOption
+	for i := range servers {
+		server := &servers[i]
+		prompt += fmt.Sprintf("\n%v. %v", i + 1, server)
+		options = append(options, func() { chosen = server })
+	}
+	prompt += fmt.Sprintf("\n%v. Enter an address", len(servers) + 1)
+	options = append(options, func() {})
+
+	setupScreen()
+	inputMenu(prompt, options...)
+
+	return chosen
+}
+
+// connect joins the server at address, over TLS if there are KnownServers to check its
+// certificate against
+func connect(login net.LoginCredentials, address string, known *net.KnownServers) (string, *rpc.Client, error) {
+	if known != nil {
+		return net.CreateSecureServerConnection(login, address, known)
+	}
+	return net.CreateServerConnection(login, address)
+}
+
+// yes returns true if the user answered a y/n prompt with yes
+func yes(answer string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(answer)), "y")
+}
@@ -0,0 +1,247 @@
+package net
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	game "github.com/jason-meredith/warships/game"
+)
+
+/*********************************************************
+ *														 *
+ *                   	  Warships						 *
+ *					   Jason Meredith					 *
+ *														 *
+ *	DATE:		October 18, 2026						 *
+ *	FILE: 		api.go									 *
+ *	PURPOSE:	JSON API over plain HTTP for tools that	 *
+ *				can't speak net/rpc. Each request is	 *
+ *				turned into the same ClientCommand an	 *
+ *				RPC would carry and run by the same		 *
+ *				Server method.							 *
+ *				 										 *
+ *														 *
+ *********************************************************/
+
+// API_PATH is where the JSON API is served, each command at API_PATH + its name
+const API_PATH = "/api/"
+
+// apiCommand is a Server command offered by the JSON API, run by the same RPC method the
+// Go client calls
+type apiCommand struct {
+	method	string
+
+	// call runs the RPC method and returns its reply, a typed reply or a *string
+	call	func(*Server, ClientCommand) (interface{}, error)
+
+	// Request parameters that make up the command's arguments, in order. Parameters
+	// left out at the end are left off the command
+	params	[]string
+}
+
+// apiCommands are the commands offered by the JSON API, by name. Joining is handled on its
+// own as it doesn't need a session yet
+var apiCommands = map[string]apiCommand{
+	"map": {http.MethodGet, func(t *Server, args ClientCommand) (interface{}, error) {
+		reply := new(MapReply)
+		return reply, t.Map(args, reply)
+	}, nil},
+	"radar": {http.MethodGet, func(t *Server, args ClientCommand) (interface{}, error) {
+		reply := new(MapReply)
+		return reply, t.Radar(args, reply)
+	}, []string{"team"}},
+	"teams": {http.MethodGet, func(t *Server, args ClientCommand) (interface{}, error) {
+		reply := new(TeamsReply)
+		return reply, t.Teams(args, reply)
+	}, nil},
+	"players": {http.MethodGet, func(t *Server, args ClientCommand) (interface{}, error) {
+		reply := new(PlayersReply)
+		return reply, t.Players(args, reply)
+	}, []string{"team"}},
+	"points": {http.MethodGet, func(t *Server, args ClientCommand) (interface{}, error) {
+		reply := new(PointsReply)
+		return reply, t.Points(args, reply)
+	}, nil},
+	"target": {http.MethodPost, func(t *Server, args ClientCommand) (interface{}, error) {
+		reply := new(ShotReply)
+		return reply, t.Target(args, reply)
+	}, []string{"team", "target"}},
+	"deploy": {http.MethodPost, func(t *Server, args ClientCommand) (interface{}, error) {
+		reply := new(DeployReply)
+		return reply, t.Deploy(args, reply)
+	}, []string{"target", "size", "orientation"}},
+	"rename": {http.MethodPost, func(t *Server, args ClientCommand) (interface{}, error) {
+		reply := new(string)
+		return reply, t.Rename(args, reply)
+	}, []string{"name"}},
+	"mutiny": {http.MethodPost, func(t *Server, args ClientCommand) (interface{}, error) {
+		reply := new(string)
+		return reply, t.Mutiny(args, reply)
+	}, []string{"name"}},
+}
+
+// apiResponse is the body sent back by the JSON API. Commands with a typed reply send it
+// in Reply, other commands send their message in Response
+type apiResponse struct {
+	Response	string		`json:"response,omitempty"`
+	Reply		interface{}	`json:"reply,omitempty"`
+	Error		string		`json:"error,omitempty"`
+}
+
+// apiHandler serves the JSON API. Players join with POST /api/join and a LoginCredentials
+// body, then send the token they are given as "Authorization: Bearer <token>". GET
+// commands take their parameters from the query string, POST commands from a JSON object
+// ex: POST /api/target {"team": 2, "target": "G7"}
+type apiHandler struct {
+	server *Server
+}
+
+// ServeHTTP runs a single JSON API request
+func (handler apiHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	server := handler.server.forConnection(req.RemoteAddr)
+	name := strings.TrimPrefix(req.URL.Path, API_PATH)
+
+	if name == "join" {
+		if req.Method != http.MethodPost {
+			writeAPIMethodNotAllowed(w, http.MethodPost)
+			return
+		}
+
+		var login LoginCredentials
+		if err := json.NewDecoder(req.Body).Decode(&login); err != nil {
+			writeAPIError(w, http.StatusBadRequest, errors.New("invalid login: "+err.Error()))
+			return
+		}
+
+		// The API speaks the current protocol for its Clients, they only need to send a
+		// version to have it checked
+		if login.ProtocolVersion == 0 {
+			login.ProtocolVersion = PROTOCOL_VERSION
+		}
+
+		var details JoinDetails
+		if err := server.JoinGame(login, &details); err != nil {
+			writeAPIError(w, apiStatus(err), err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, details)
+		return
+	}
+
+	command, exists := apiCommands[name]
+	if !exists {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("command '%v' not found", name))
+		return
+	}
+
+	if req.Method != command.method {
+		writeAPIMethodNotAllowed(w, command.method)
+		return
+	}
+
+	params, err := apiParams(req)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	fields := []string{name}
+	for _, param := range command.params {
+		value, given := params[param]
+		if !given {
+			break
+		}
+		fields = append(fields, value)
+	}
+
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+
+	reply, err := command.call(server, ClientCommand{Token: token, Fields: fields})
+	if err != nil {
+		writeAPIError(w, apiStatus(err), err)
+		return
+	}
+
+	if response, isString := reply.(*string); isString {
+		writeJSON(w, http.StatusOK, apiResponse{Response: *response})
+	} else {
+		writeJSON(w, http.StatusOK, apiResponse{Reply: reply})
+	}
+}
+
+// apiParams reads a request's parameters from its query string and, for POST requests,
+// its JSON body. Numbers in the body are accepted as well as strings
+func apiParams(req *http.Request) (map[string]string, error) {
+
+	params := make(map[string]string)
+	for key, values := range req.URL.Query() {
+		params[key] = values[0]
+	}
+
+	if req.Method != http.MethodPost {
+		return params, nil
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil && err != io.EOF {
+		return nil, errors.New("request body must be a JSON object: " + err.Error())
+	}
+
+	for key, value := range body {
+		switch value.(type) {
+		case string, float64:
+			params[key] = fmt.Sprint(value)
+		default:
+			return nil, fmt.Errorf("parameter '%v' must be a string or a number", key)
+		}
+	}
+
+	return params, nil
+}
+
+// apiStatus picks the HTTP status code for an error returned by a command. Anything not
+// listed is a command the Game rules or the arguments didn't allow
+func apiStatus(err error) int {
+
+	switch err {
+	case ErrUnauthorized, game.ErrServerPassword, game.ErrIncorrectPassword:
+		return http.StatusUnauthorized
+	case ErrForbidden, ErrSpectator:
+		return http.StatusForbidden
+	case game.ErrGameFull:
+		return http.StatusServiceUnavailable
+	}
+
+	if _, banned := err.(*game.Ban); banned {
+		return http.StatusForbidden
+	}
+
+	if _, outdated := err.(*IncompatibleVersion); outdated {
+		return http.StatusUpgradeRequired
+	}
+
+	return http.StatusBadRequest
+}
+
+// writeAPIError sends an error body with the given status code
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, apiResponse{Error: err.Error()})
+}
+
+// writeAPIMethodNotAllowed tells the Client which method the command needs
+func writeAPIMethodNotAllowed(w http.ResponseWriter, method string) {
+	w.Header().Set("Allow", method)
+	writeAPIError(w, http.StatusMethodNotAllowed, fmt.Errorf("method must be %v", method))
+}
+
+// writeJSON sends value as a JSON body with the given status code
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,296 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	game "github.com/jason-meredith/warships/game"
+)
+
+/*********************************************************
+ *														 *
+ *                   	  Warships						 *
+ *					   Jason Meredith					 *
+ *														 *
+ *	DATE:		October 18, 2026						 *
+ *	FILE: 		chat.go									 *
+ *	PURPOSE:	In-game chat. Messages are stored per	 *
+ *				channel: one for everyone, one for each	 *
+ *				Team and one for each pair of Players	 *
+ *				talking privately. New messages reach	 *
+ *				Clients through Subscribe.				 *
+ *				 										 *
+ *														 *
+ *********************************************************/
+
+const (
+	// CHAT_ALL is the channel every Player and spectator can read
+	CHAT_ALL = "all"
+
+	// CHAT_HISTORY_SIZE is how many messages are kept in each channel
+	CHAT_HISTORY_SIZE = 200
+
+	// CHAT_MAX_LENGTH is the longest message that can be sent, in characters
+	CHAT_MAX_LENGTH = 280
+)
+
+// ChatMessage is a single message sent to a channel
+type ChatMessage struct {
+	Id		int
+	Time	time.Time
+	Channel	string
+	From	string
+
+	// Recipient of a private message, empty for everything else
+	To		string
+
+	Text	string
+}
+
+// String formats the ChatMessage the way it is shown to Players
+func (message *ChatMessage) String() string {
+	switch {
+	case message.To != "":
+		return fmt.Sprintf("[@%v -> %v] %v", message.From, message.To, message.Text)
+	case message.Channel == CHAT_ALL:
+		return fmt.Sprintf("[ALL] %v: %v", message.From, message.Text)
+	default:
+		return fmt.Sprintf("[TEAM] %v: %v", message.From, message.Text)
+	}
+}
+
+// ChatRoom stores the messages of every channel and keeps track of which messages each
+// Player has been sent. RPCs are served concurrently so all access goes through the mutex
+type ChatRoom struct {
+	mutex		sync.Mutex
+	lastId		int
+	channels	map[string][]*ChatMessage
+
+	// Id of the newest message each Player has been sent on any session, where their
+	// next session starts
+	cursors		map[*game.Player]int
+
+	// Usernames each Player has muted or ignored, see moderation.go
+	muted		map[*game.Player]map[string]bool
+	ignored		map[*game.Player]map[string]bool
+
+	// Usernames an admin has silenced and when the silence ends
+	silenced	map[string]time.Time
+
+	// When each Player sent their recent messages, for rate limiting
+	sent		map[*game.Player][]time.Time
+
+	// Every message is written here if it is set, see OpenLog
+	log			io.WriteCloser
+}
+
+// NewChatRoom creates a ChatRoom with no messages
+func NewChatRoom() *ChatRoom {
+	return &ChatRoom{
+		channels: make(map[string][]*ChatMessage),
+		cursors:  make(map[*game.Player]int),
+		muted:    make(map[*game.Player]map[string]bool),
+		ignored:  make(map[*game.Player]map[string]bool),
+		silenced: make(map[string]time.Time),
+		sent:     make(map[*game.Player][]time.Time),
+	}
+}
+
+// TeamChannel returns the name of a Team's channel
+func TeamChannel(team *game.Team) string {
+	return fmt.Sprintf("team-%v", team.Id)
+}
+
+// PrivateChannel returns the name of the channel between two Players, the same whichever
+// way round they are given. Usernames are quoted so no two pairs share a channel
+func PrivateChannel(a, b string) string {
+	names := []string{a, b}
+	sort.Strings(names)
+	return fmt.Sprintf("@%q|%q", names[0], names[1])
+}
+
+// Join starts a Player's messages from now, so they aren't sent everything said before
+// they arrived. Players who have joined before carry on where they left off. Returns the
+// Id of the newest message the Player has been sent, where their new session starts
+func (room *ChatRoom) Join(player *game.Player) int {
+	room.mutex.Lock()
+	defer room.mutex.Unlock()
+
+	if _, exists := room.cursors[player]; !exists {
+		room.cursors[player] = room.lastId
+	}
+
+	return room.cursors[player]
+}
+
+// Post adds a message to a channel and returns it
+func (room *ChatRoom) Post(channel, from, to, text string) *ChatMessage {
+	room.mutex.Lock()
+	defer room.mutex.Unlock()
+
+	room.lastId++
+	message := &ChatMessage{room.lastId, time.Now(), channel, from, to, text}
+
+	messages := append(room.channels[channel], message)
+	if len(messages) > CHAT_HISTORY_SIZE {
+		messages = messages[len(messages)-CHAT_HISTORY_SIZE:]
+	}
+	room.channels[channel] = messages
+
+	if room.log != nil {
+		fmt.Fprintf(room.log, "%v [%v] %v\n", message.Time.Format("2006-01-02 15:04:05"), channel, message)
+	}
+
+	return message
+}
+
+// Unread returns the messages newer than seen, the Id of the newest message a session has
+// been sent, oldest first and moves seen past them. Players read everyone's channel, their
+// Team's channel and their private channels, spectators only read everyone's channel
+func (room *ChatRoom) Unread(player *game.Player, seen *int) []*ChatMessage {
+	room.mutex.Lock()
+	defer room.mutex.Unlock()
+
+	cursor := *seen
+
+	var unread []*ChatMessage
+	for _, messages := range room.channels {
+		for _, message := range messages {
+			if message.Id > cursor && message.From != player.Username && canRead(player, message) &&
+				!room.hidden(player, message) {
+				unread = append(unread, message)
+			}
+		}
+	}
+
+	sort.Slice(unread, func(i, j int) bool {
+		return unread[i].Id < unread[j].Id
+	})
+
+	*seen = room.lastId
+	room.cursors[player] = room.lastId
+
+	return unread
+}
+
+// canRead returns true if a Player can read a message. Private messages are checked one
+// by one, so only the two Players in the conversation ever see them
+func canRead(player *game.Player, message *ChatMessage) bool {
+
+	if message.Channel == CHAT_ALL {
+		return true
+	}
+
+	if player.Spectator {
+		return false
+	}
+
+	if strings.HasPrefix(message.Channel, "@") {
+		return message.From == player.Username || message.To == player.Username
+	}
+
+	return message.Channel == TeamChannel(player.Team)
+}
+
+// parseChat works out the channel, recipient and text of a chat command. The first field
+// starts with $ for everyone, # for the Player's Team or @ for a private message, the
+// recipient can follow the @ directly or after a space
+func parseChat(fields []string) (prefix byte, to string, text string, err error) {
+
+	if len(fields) == 0 || len(fields[0]) == 0 {
+		return 0, "", "", errors.New("message is empty")
+	}
+
+	prefix = fields[0][0]
+	words := append([]string{fields[0][1:]}, fields[1:]...)
+
+	if prefix == '@' {
+		if words[0] == "" {
+			words = words[1:]
+		}
+		if len(words) == 0 {
+			return 0, "", "", errors.New("must choose who to message: @<username> <message>")
+		}
+		to, words = words[0], words[1:]
+	} else if prefix != '$' && prefix != '#' {
+		return 0, "", "", errors.New("chat messages start with $, # or @, type 'help' for more")
+	}
+
+	text = strings.TrimSpace(strings.Join(words, " "))
+	if text == "" {
+		return 0, "", "", errors.New("message is empty")
+	}
+
+	if len([]rune(text)) > CHAT_MAX_LENGTH {
+		return 0, "", "", fmt.Errorf("message is too long, the limit is %v characters", CHAT_MAX_LENGTH)
+	}
+
+	return prefix, to, text, nil
+}
+
+// chat sends a message: $ <message> for everyone, # <message> for the Player's Team and
+// @<username> <message> for a single Player
+func (t *Server) chat(player *game.Player, args ClientCommand, response *string) error {
+
+	prefix, to, text, err := parseChat(args.Fields)
+	if err != nil {
+		return err
+	}
+
+	if err := t.chatRoom.CanSend(player); err != nil {
+		return err
+	}
+
+	var channel string
+	switch prefix {
+	case '$':
+		channel = CHAT_ALL
+	case '#':
+		channel = TeamChannel(player.Team)
+	case '@':
+		recipient := t.game.GetPlayerByUsername(to)
+		if recipient == nil {
+			return errors.New("there is no player with that username")
+		}
+		if recipient == player {
+			return errors.New("you cannot message yourself")
+		}
+		if t.chatRoom.Ignoring(recipient, player.Username) {
+			return errors.New("that player is not accepting your messages")
+		}
+		channel = PrivateChannel(player.Username, recipient.Username)
+	}
+
+	message := t.chatRoom.Post(channel, player.Username, to, text)
+
+	*response = message.String()
+
+	timeStamp()
+	fmt.Printf("Chat Message\n")
+	fmt.Printf("\t-Player: %v (%v)\n", player.Username, player.Id)
+	fmt.Printf("\t-Channel: %v\n", channel)
+
+	return nil
+}
+
+// chatPoll sends a Client every message it hasn't been sent yet, one per line
+func (t *Server) chatPoll(player *game.Player, args ClientCommand, response *string) error {
+
+	session, err := t.sessions.lookup(args.Token, false)
+	if err != nil {
+		return err
+	}
+
+	output := ""
+	for _, message := range t.chatRoom.Unread(player, &session.ChatSeen) {
+		output += message.String() + "\n"
+	}
+
+	*response = output
+
+	return nil
+}
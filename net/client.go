@@ -4,10 +4,12 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"net"
 	"net/rpc"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 /*********************************************************
@@ -23,32 +25,55 @@ import (
  *														 *
  *********************************************************/
 
-// ClientCommand wraps the PlayerID and command input into a single struct to send to server
+// screen stops text pushed by the Server and command responses printing over each other
+var screen sync.Mutex
+
+// serverCommands are the RPC calls the Server the Client joined supports. Commands the
+// Server lacks are hidden from the user instead of failing on the Server
+var serverCommands map[string]bool
+
+// ClientCommand wraps the session token and command input into a single struct to send to server
 type ClientCommand struct {
-	PlayerId string
-	Fields   []string
+	Token  string
+	Fields []string
 }
 
-// CreateServerConnection takes a username, password and network address and attempts to connect
-// to a Game server running at that location. If a user using that username has never connected
+// CreateServerConnection takes LoginCredentials and a network address and attempts to connect
+// to a Game server running at that location, given as host or host:port. The server password
+// is only needed if the server was started with one, and the team code only if the Player
+// has been invited to a Team. If a user using that username has never connected
 // to that server before a Player is created on the server with the given username and password.
 //
 // If a Player already exists on that server the password entered must be the password they entered
 // when they first logged in or else they must re-login with a new username/password combo.
 //
-// Upon successful login a string (their UserID) and the RPC Client object are returned, or an error.
-func CreateServerConnection(username, password, address string) (string, *rpc.Client, error) {
+// Upon successful login a string (their session token) and the RPC Client object are returned, or an error.
+func CreateServerConnection(login LoginCredentials, address string) (string, *rpc.Client, error) {
+	return createServerConnection(login, address, nil)
+}
+
+// CreateSecureServerConnection is CreateServerConnection over TLS, for servers started with
+// TLS. The first time a server is connected to its certificate is pinned in known, after
+// that the connection is refused if the server shows a different certificate
+func CreateSecureServerConnection(login LoginCredentials, address string, known *KnownServers) (string, *rpc.Client, error) {
+	return createServerConnection(login, address, known)
+}
+
+// createServerConnection connects and joins, over TLS if known is given
+func createServerConnection(login LoginCredentials, address string, known *KnownServers) (string, *rpc.Client, error) {
 
 	// Create connection to server
-	client, err := rpc.DialHTTP("tcp", address+":"+strconv.Itoa(RPC_PORT))
+	client, err := dialRPC(ServerAddress(address, RPC_PORT), known)
 	if err != nil {
+		if known != nil {
+			return "", nil, errors.New("unable to connect securely to that address: " + err.Error())
+		}
 		return "", nil, errors.New("unable to connect to that address")
 	}
 
-	login := LoginCredentials{
-		Username: username,
-		Password: password,
-	}
+	// Tell the Server which protocol version and commands this Client has
+	login.ProtocolVersion = PROTOCOL_VERSION
+	login.Commands = ClientCommands()
 
 	var details JoinDetails
 
@@ -57,16 +82,58 @@ func CreateServerConnection(username, password, address string) (string, *rpc.Cl
 		return "", nil, err
 	}
 
+	// Servers from before the handshake send no version at all
+	if err := checkProtocol(details.ProtocolVersion, true); err != nil {
+		var response string
+		client.Call("Server.Logout", &ClientCommand{Token: details.Token, Fields: []string{"logout"}}, &response)
+		client.Close()
+		return "", nil, err
+	}
+
+	serverCommands = make(map[string]bool)
+	for _, rpcCall := range details.Commands {
+		serverCommands[rpcCall] = true
+	}
+
 	fmt.Printf("Joined Game with ID %v\n", details.PlayerId)
 	fmt.Printf("Assigned to team: %v\n", details.TeamName)
 
-	return details.PlayerId, client, nil
+	return details.Token, client, nil
 
 }
 
+// CHAT_PREFIXES are the characters that start a chat message instead of a command
+const CHAT_PREFIXES = "$#@"
+
+// ServerAddress adds a port to a server address that doesn't have one. Addresses already
+// in host:port form are left alone
+func ServerAddress(address string, port uint16) string {
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+
+	return net.JoinHostPort(address, strconv.Itoa(int(port)))
+}
+
 // GetCommand maps the first field in a user input to a Server RPC call function
 // Return the ServerCall string and a boolean if its a valid call
 func GetCommand(input string) (string, bool) {
+
+	// Chat messages go to everyone ($), the team (#) or a single player (@)
+	if len(input) > 0 && strings.ContainsRune(CHAT_PREFIXES, rune(input[0])) {
+		return "Server.Chat", true
+	}
+
+	if value, exists := commandMap()[input]; exists {
+		return value, exists
+	} else {
+		return "", false
+	}
+}
+
+// commandMap maps each command the user can type to its Server RPC call
+func commandMap() map[string]string {
+
 	// Map the client commands to remote function calls
 	var commands map[string]string
 	commands = make(map[string]string)
@@ -82,66 +149,128 @@ func GetCommand(input string) (string, bool) {
 	commands["rename"] = "Server.Rename"     // Rename a team
 	commands["mutiny"] = "Server.Mutiny"     // Steal deployment points to start a new team
 	commands["points"] = "Server.Points"     // Display how many deployment points your team has
+	commands["switch"] = "Server.Switch"     // Leave your team and join another
+	commands["logout"] = "Server.Logout"     // End your session
+	commands["ally"] = "Server.Ally"         // Propose, accept or break an alliance
+	commands["invite"] = "Server.Invite"     // Make your team private, create or use invite codes
+	commands["merge"] = "Server.Merge"       // Propose or accept merging with another team
+	commands["admin"] = "Server.Admin"       // Log in as server admin
+	commands["kick"] = "Server.Kick"         // Remove a player (admin)
+	commands["ban"] = "Server.Ban"           // Remove a player and keep them out (admin)
+	commands["unban"] = "Server.Unban"       // Lift a ban (admin)
+	commands["delay"] = "Server.Delay"       // Set how far behind the game spectators see (admin)
+	commands["bot"] = "Server.Bot"           // Add, remove or list bots (admin)
+	commands["stats"] = "Server.Stats"       // Show a player's rating and lifetime stats
+	commands["help"] = "Server.ChatHelp"     // Show how to chat
+	commands["history"] = "Server.History"   // Scroll back through a chat channel
+	commands["mute"] = "Server.Mute"         // Hide (or unhide) a player's chat messages
+	commands["ignore"] = "Server.Ignore"     // Hide a player's messages and block their private messages
+	commands["silence"] = "Server.Silence"   // Stop a player chatting for a while (admin)
+	commands["announce"] = "Server.Announce" // Broadcast a message to everyone (admin)
 
-	if value, exists := commands[input]; exists {
-		return value, exists
-	} else {
-		return "", false
-	}
+	return commands
 }
 
 // AcceptCommands presents the user with an input prompt, repeatedly accepting input delimited
 // with a newline until the user enters 'quit'
-func AcceptCommands(playerId string, connection *rpc.Client) {
+func AcceptCommands(token string, connection *rpc.Client) {
 
 	reader := bufio.NewReader(os.Stdin)
 	var input string
 
+	go subscribeFeed(token, connection)
+
 	for {
 
 		if input == "quit" {
+			SendCommand(token, connection, "logout")
 			os.Exit(0)
 		}
 
+		screen.Lock()
 		fmt.Printf("> ")
+		screen.Unlock()
 
 		// Get user input
 		input, _ = reader.ReadString('\n')
 		input = strings.TrimRight(input, "\n")
 
 		// Parse input
-		SendCommand(playerId, connection, input)
+		SendCommand(token, connection, input)
+
+	}
+}
+
+// subscribeFeed keeps a Subscribe call open in the background and shows whatever the
+// Server sends back as soon as it arrives, so Players hear about shots, sinks and chat
+// without having to send a command. Stops once the session ends
+func subscribeFeed(token string, connection *rpc.Client) {
+	for {
+		var response string
+		err := connection.Call("Server.Subscribe", &ClientCommand{Token: token}, &response)
+		if err != nil {
+			return
+		}
 
+		if response != "" {
+			printAbovePrompt(response)
+		}
 	}
 }
 
-// AcceptCommands takes a the UserID, RPC Client object and raw user input
+// printAbovePrompt shows text on new lines above the prompt without touching whatever the
+// user has typed so far. The screen is scrolled up to make room, blank lines are inserted
+// above the prompt line to push it back down, the text is written into them and the
+// cursor is put back where it was
+func printAbovePrompt(text string) {
+
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	n := len(lines)
+
+	screen.Lock()
+	defer screen.Unlock()
+
+	fmt.Printf("\0337\033[%vS\033[%vA\r\033[%vL%v\0338", n, n, n, strings.Join(lines, "\r\n"))
+}
+
+// SendCommand takes a the session token, RPC Client object and raw user input
 // If the first token of the input matches a key in hashmap of commands
-// their UserID and full input are sent to the server wrapped in ClientCommand struct.
-// Response string from server is printed to screen.
-func SendCommand(playerId string, connection *rpc.Client, input string) {
-	var response string
+// their session token and full input are sent to the server wrapped in ClientCommand struct.
+// The reply from the server is rendered and printed to screen.
+func SendCommand(token string, connection *rpc.Client, input string) {
 
 	// Split input string into space-delimited array
 	fields := strings.Fields(input)
+	if len(fields) == 0 {
+		return
+	}
 
 	// Make sure its a valid server command and get its corresponding RPC call
 	rpcCall, valid := GetCommand(fields[0])
+	if valid && serverCommands != nil && !serverCommands[rpcCall] {
+		valid = false
+	}
+
+	// Hold back anything pushed by the Server until the response has been shown
+	screen.Lock()
+	defer screen.Unlock()
 
 	if valid {
 
 		// Wrap command in ClientCommand struct
-		command := ClientCommand{PlayerId: playerId, Fields: fields}
+		command := ClientCommand{Token: token, Fields: fields}
 
-		// Run the command
-		err := connection.Call(rpcCall, &command, &response)
+		// Run the command, commands that return game data send a typed reply which is
+		// rendered here
+		reply := NewReply(rpcCall)
+		err := connection.Call(rpcCall, &command, reply)
 		if err != nil {
 			fmt.Println("Error: " + err.Error())
-
+			return
 		}
+
+		fmt.Println(Render(reply))
 	} else {
 		fmt.Printf("Command '%v' not found.\n", input)
 	}
-
-	fmt.Println(response)
 }
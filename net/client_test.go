@@ -1,8 +1,14 @@
 package net
 
 import (
+	"crypto/tls"
 	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
 	"net/rpc"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -18,11 +24,14 @@ func runServer() {
 
 }
 
-func endServer(connection *rpc.Client) {
-	command := ClientCommand{ PlayerId: "0", Fields: []string{"shutdown", "adminpass"} }
+func endServer(token string, connection *rpc.Client) {
+	var response string
+	admin := ClientCommand{ Token: token, Fields: []string{"admin", "adminpass"} }
+	connection.Call("Server.Admin", &admin, &response)
 
 	// Send ClientCommand to Server and print response
-	connection.Call("Server.Shutdown", &command, nil)
+	command := ClientCommand{ Token: token, Fields: []string{"shutdown"} }
+	connection.Call("Server.Shutdown", &command, &response)
 
 }
 
@@ -34,11 +43,11 @@ func TestCreateServerConnection(t *testing.T) {
 	runServer()
 	fmt.Println("Server running, starting client")
 	time.Sleep(1 * time.Second)
-	userId, connection, err := CreateServerConnection("j", "j", "127.0.0.1")
-	defer endServer(connection)
+	token, connection, err := CreateServerConnection(LoginCredentials{Username: "j", Password: "j", ServerPassword: "pass"}, "127.0.0.1")
+	defer endServer(token, connection)
 
-	if userId == "" {
-		t.Error("Error creating connection to server, no userid")
+	if token == "" {
+		t.Error("Error creating connection to server, no session token")
 	}
 
 	if connection == nil {
@@ -59,38 +68,38 @@ func TestServer_Target(t *testing.T) {
 	runServer()
 	fmt.Println("Server running, starting client")
 	time.Sleep(1 * time.Second)
-	userId, connection, _ := CreateServerConnection("j", "j", "127.0.0.1")
-	CreateServerConnection("k","k", "127.0.0.1")
-	defer endServer(connection)
+	token, connection, _ := CreateServerConnection(LoginCredentials{Username: "j", Password: "j", ServerPassword: "pass"}, "127.0.0.1")
+	CreateServerConnection(LoginCredentials{Username: "k", Password: "k", ServerPassword: "pass"}, "127.0.0.1")
+	defer endServer(token, connection)
 
-	var response string
+	var response ShotReply
 
 
 	// Try targeting your their own team
-	command := ClientCommand{ PlayerId: userId, Fields: []string{"target", "1", "A1"} }
+	command := ClientCommand{ Token: token, Fields: []string{"target", "1", "A1"} }
 	err := connection.Call("Server.Target", &command, &response)
 	if err.Error() != "you cannot target your own team" {
 		t.Error("Should have returned error when targeting own team")
 	}
 
 	// Try targeting non-existant team
-	command = ClientCommand{ PlayerId: userId, Fields: []string{"target", "3", "A1"} }
+	command = ClientCommand{ Token: token, Fields: []string{"target", "3", "A1"} }
 	err = connection.Call("Server.Target", &command, &response)
-	if err.Error() != "not a valid target number. Run 'teams' to see a list of teams and their team#" {
+	if err.Error() != "no team with that ID or name. Run 'teams' to see a list of teams and their IDs" {
 		t.Error("Should have returned error when targeting non-existing team number")
 	}
 
 
 	// Try targeting  non-existant team
-	command = ClientCommand{ PlayerId: userId, Fields: []string{"target", "0", "A1"} }
+	command = ClientCommand{ Token: token, Fields: []string{"target", "0", "A1"} }
 	err = connection.Call("Server.Target", &command, &response)
-	if err.Error() != "not a valid target number. Run 'teams' to see a list of teams and their team#" {
+	if err.Error() != "no team with that ID or name. Run 'teams' to see a list of teams and their IDs" {
 		t.Error("Should have returned error when targeting non-existing team number")
 	}
 
 
 	// Try targeting your their own team
-	command = ClientCommand{ PlayerId: userId, Fields: []string{"target", "2" } }
+	command = ClientCommand{ Token: token, Fields: []string{"target", "2" } }
 	err = connection.Call("Server.Target", &command, &response)
 	if err.Error() != "not enough arguments to perform target command: target <team#> <target_coordinate>" {
 		t.Error("Should have returned error when not enough args in command")
@@ -101,9 +110,9 @@ func TestServer_Target(t *testing.T) {
 
 
 
-	command = ClientCommand{ PlayerId: userId, Fields: []string{"target", "2", "c4"} }
+	command = ClientCommand{ Token: token, Fields: []string{"target", "2", "c4"} }
 	err = connection.Call("Server.Target", &command, &response)
-	if response != "Shot confirmed HIT!\n1 hit streak\n" {
+	if response.Render() != "Shot confirmed HIT!\n1 hit streak\n" {
 		t.Error("Hit should have registered as a hit")
 	}
 
@@ -111,3 +120,168 @@ func TestServer_Target(t *testing.T) {
 
 }
 
+
+func TestServerAddress(t *testing.T) {
+
+	addresses := map[string]string{
+		"127.0.0.1":      "127.0.0.1:51832",
+		"127.0.0.1:4000": "127.0.0.1:4000",
+		"example.com":    "example.com:51832",
+		"::1":            "[::1]:51832",
+		"[::1]:4000":     "[::1]:4000",
+	}
+
+	for address, expected := range addresses {
+		if result := ServerAddress(address, RPC_PORT); result != expected {
+			t.Errorf("ServerAddress(%v) = %v, expected %v", address, result, expected)
+		}
+	}
+}
+
+func TestCreateServerConnection_Port(t *testing.T) {
+
+	// Serve on a port other than RPC_PORT and connect with host:port
+	server := newTestServer()
+	listener := httptest.NewServer(rpcHandler{server})
+	defer listener.Close()
+
+	token, connection, err := CreateServerConnection(LoginCredentials{Username: "j", Password: "j"},
+		listener.Listener.Addr().String())
+	if err != nil || token == "" {
+		t.Fatal("Error creating connection to server on a custom port: ", err)
+	}
+	connection.Close()
+}
+
+// oldServer answers JoinGame the way Servers did before the protocol handshake
+type oldServer struct {
+	loggedOut chan bool
+}
+
+func (s *oldServer) JoinGame(login LoginCredentials, details *JoinDetails) error {
+	*details = JoinDetails{PlayerId: "1", TeamName: "Old", Token: "old"}
+	return nil
+}
+
+func (s *oldServer) Logout(args ClientCommand, response *string) error {
+	s.loggedOut <- true
+	return nil
+}
+
+func TestCreateServerConnection_Handshake(t *testing.T) {
+
+	server := newTestServer()
+	listener := httptest.NewServer(rpcHandler{server})
+	defer listener.Close()
+
+	_, connection, err := CreateServerConnection(LoginCredentials{Username: "j", Password: "j"},
+		listener.Listener.Addr().String())
+	if err != nil {
+		t.Fatal("Error creating connection to server: ", err)
+	}
+	connection.Close()
+
+	// The Server has no Sweep, so the Client shouldn't offer it
+	if !serverCommands["Server.Target"] || serverCommands["Server.Sweep"] {
+		t.Error("Client should only offer the commands the Server supports")
+	}
+
+	old := &oldServer{loggedOut: make(chan bool, 1)}
+	rpcServer := rpc.NewServer()
+	rpcServer.RegisterName("Server", old)
+	oldListener := httptest.NewServer(rpcServer)
+	defer oldListener.Close()
+
+	_, _, err = CreateServerConnection(LoginCredentials{Username: "j", Password: "j"}, oldListener.Listener.Addr().String())
+	if _, outdated := err.(*IncompatibleVersion); !outdated || !strings.Contains(err.Error(), "server is out of date") {
+		t.Errorf("Joining a Server from before the handshake should fail clearly, got %v", err)
+	}
+
+	select {
+	case <-old.loggedOut:
+	case <-time.After(time.Second):
+		t.Error("Client should log out of a Server it can't talk to")
+	}
+}
+
+func TestCreateSecureServerConnection(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "warships")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	// The first start generates a certificate, later starts load the same one
+	cert, created, err := LoadOrCreateCertificate(certFile, keyFile)
+	if err != nil || !created {
+		t.Fatal("Certificate should be generated when there isn't one: ", err)
+	}
+	reloaded, created, err := LoadOrCreateCertificate(certFile, keyFile)
+	if err != nil || created || CertificateFingerprint(reloaded.Certificate[0]) != CertificateFingerprint(cert.Certificate[0]) {
+		t.Fatal("Saved certificate should be loaded on later starts: ", err)
+	}
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Error("Private key should only be readable by its owner")
+	}
+
+	os.Remove(keyFile)
+	if _, _, err := LoadOrCreateCertificate(certFile, keyFile); err == nil {
+		t.Error("A certificate without its key should not be replaced")
+	}
+
+	server := newTestServer()
+	listener := httptest.NewUnstartedServer(rpcHandler{server})
+	listener.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	listener.StartTLS()
+	defer listener.Close()
+	address := listener.Listener.Addr().String()
+
+	if _, _, err := CreateServerConnection(LoginCredentials{Username: "j", Password: "j"}, address); err == nil {
+		t.Error("Connecting without TLS to a TLS server should fail")
+	}
+
+	// Trusted on first use, and pinned for next time
+	known, _ := LoadKnownServers(filepath.Join(dir, "known.json"))
+	token, connection, err := CreateSecureServerConnection(LoginCredentials{Username: "j", Password: "j"}, address, known)
+	if err != nil || token == "" {
+		t.Fatal("Error connecting over TLS: ", err)
+	}
+	connection.Close()
+
+	known, _ = LoadKnownServers(known.Path)
+	if known.Fingerprints[address] != CertificateFingerprint(cert.Certificate[0]) {
+		t.Fatal("Server certificate should be pinned on first use")
+	}
+
+	if _, connection, err = CreateSecureServerConnection(LoginCredentials{Username: "j", Password: "j"}, address, known); err != nil {
+		t.Fatal("Pinned certificate should be accepted: ", err)
+	}
+	connection.Close()
+
+	known.Fingerprints[address] = "0000"
+	if _, _, err := CreateSecureServerConnection(LoginCredentials{Username: "j", Password: "j"}, address, known); err == nil ||
+		!strings.Contains(err.Error(), "has changed") {
+		t.Error("A different certificate than the one pinned should be refused: ", err)
+	}
+
+	// A server showing a certificate it doesn't hold the key to fails the handshake, and
+	// its certificate must not be pinned
+	other, _, _ := LoadOrCreateCertificate(filepath.Join(dir, "other.pem"), filepath.Join(dir, "other.key"))
+	impostor := httptest.NewUnstartedServer(rpcHandler{server})
+	impostor.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: cert.Certificate, PrivateKey: other.PrivateKey}}}
+	impostor.StartTLS()
+	defer impostor.Close()
+	impostorAddress := impostor.Listener.Addr().String()
+
+	known, _ = LoadKnownServers(filepath.Join(dir, "impostor.json"))
+	if _, _, err := CreateSecureServerConnection(LoginCredentials{Username: "j", Password: "j"}, impostorAddress, known); err == nil {
+		t.Error("Server without the certificate's key should fail the handshake")
+	}
+	if _, pinned := known.Fingerprints[impostorAddress]; pinned {
+		t.Error("Certificate should not be pinned when the handshake fails")
+	}
+}
@@ -0,0 +1,219 @@
+package net
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+)
+
+/*********************************************************
+ *														 *
+ *                   	  Warships						 *
+ *					   Jason Meredith					 *
+ *														 *
+ *	DATE:		October 18, 2026						 *
+ *	FILE: 		discovery.go							 *
+ *	PURPOSE:	Finds Games on the local network. Each	 *
+ *				Server broadcasts an announcement over	 *
+ *				UDP every few seconds and Clients		 *
+ *				listen for them to list what's running.	 *
+ *				 										 *
+ *														 *
+ *********************************************************/
+
+const (
+	// DISCOVERY_PORT is the UDP port Servers announce themselves on
+	DISCOVERY_PORT = 51833
+
+	// DISCOVERY_INTERVAL is how often a Server announces itself
+	DISCOVERY_INTERVAL = 2 * time.Second
+
+	// DISCOVERY_TIMEOUT is how long Clients listen for announcements, long enough to hear
+	// every Server at least once
+	DISCOVERY_TIMEOUT = 3 * time.Second
+
+	// DISCOVERY_GAME marks announcements as coming from Warships, anything else sent to
+	// DISCOVERY_PORT is ignored
+	DISCOVERY_GAME = "warships"
+
+	// DISCOVERY_MAX_PACKET is the largest announcement read
+	DISCOVERY_MAX_PACKET = 2048
+)
+
+// ServerAnnouncement is what a Server tells the local network about its Game
+type ServerAnnouncement struct {
+	Game	string	`json:"game"`
+	Name	string	`json:"name"`
+	Port	uint16	`json:"port"`
+
+	Players		int		`json:"players"`
+	MaxPlayers	uint8	`json:"maxPlayers"`
+	BoardSize	uint8	`json:"boardSize"`
+
+	// True if the Game needs a server password to join, and if it is served over TLS
+	Password	bool	`json:"password"`
+	TLS			bool	`json:"tls"`
+
+	ProtocolVersion	int	`json:"protocolVersion"`
+
+	// Where the Server can be reached as host:port, filled in by the Client from where
+	// the announcement came from
+	Address	string	`json:"-"`
+}
+
+// String describes the Game in a line for the join menu
+func (announcement ServerAnnouncement) String() string {
+
+	players := fmt.Sprintf("%v", announcement.Players)
+	if announcement.MaxPlayers != 0 {
+		players += fmt.Sprintf("/%v", announcement.MaxPlayers)
+	}
+
+	output := fmt.Sprintf("%v (%v) - %v players, %vx%v board", announcement.Name, announcement.Address,
+		players, announcement.BoardSize, announcement.BoardSize)
+
+	if announcement.Password {
+		output += ", password required"
+	}
+	if announcement.TLS {
+		output += ", TLS"
+	}
+	if checkProtocol(announcement.ProtocolVersion, true) != nil {
+		output += ", out of date"
+	}
+
+	return output
+}
+
+// announcement describes the Game for the local network. The Game must be locked
+func (t *Server) announcement() ServerAnnouncement {
+	return ServerAnnouncement{
+		Game:            DISCOVERY_GAME,
+		Name:            t.game.Name,
+		Port:            t.game.Port,
+		Players:         t.game.NumPlayers(),
+		MaxPlayers:      t.game.MaxPlayers,
+		BoardSize:       t.game.BoardSize,
+		Password:        t.game.Password != "",
+		TLS:             t.game.TLS,
+		ProtocolVersion: PROTOCOL_VERSION,
+	}
+}
+
+// advertise broadcasts the Server's announcement on every network it is connected to
+// every DISCOVERY_INTERVAL for as long as the Game is live
+func (t *Server) advertise(conn *net.UDPConn) {
+
+	defer conn.Close()
+
+	for {
+		t.game.Lock()
+		live := t.game.Live
+		announcement := t.announcement()
+		t.game.Unlock()
+
+		if !live {
+			return
+		}
+
+		sendAnnouncement(conn, announcement, broadcastAddresses(DISCOVERY_PORT))
+		time.Sleep(DISCOVERY_INTERVAL)
+	}
+}
+
+// sendAnnouncement sends an announcement to each address. Networks that can't be reached
+// are skipped, the next announcement will try them again
+func sendAnnouncement(conn *net.UDPConn, announcement ServerAnnouncement, addresses []*net.UDPAddr) {
+
+	packet, err := json.Marshal(announcement)
+	if err != nil {
+		return
+	}
+
+	for _, address := range addresses {
+		conn.WriteToUDP(packet, address)
+	}
+}
+
+// broadcastAddresses returns the broadcast address of every IPv4 network the machine is
+// on, along with the limited broadcast address which reaches the local network when
+// interfaces can't be listed
+func broadcastAddresses(port int) []*net.UDPAddr {
+
+	addresses := []*net.UDPAddr{{IP: net.IPv4bcast, Port: port}}
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return addresses
+	}
+
+	for _, iface := range interfaces {
+		if iface.Flags & net.FlagUp == 0 || iface.Flags & net.FlagBroadcast == 0 {
+			continue
+		}
+
+		networks, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+
+		for _, network := range networks {
+			ipNet, ok := network.(*net.IPNet)
+			if !ok || ipNet.IP.To4() == nil || len(ipNet.Mask) != net.IPv4len {
+				continue
+			}
+
+			// Set every host bit of the network's address
+			broadcast := make(net.IP, net.IPv4len)
+			for i, b := range ipNet.IP.To4() {
+				broadcast[i] = b | ^ipNet.Mask[i]
+			}
+			addresses = append(addresses, &net.UDPAddr{IP: broadcast, Port: port})
+		}
+	}
+
+	return addresses
+}
+
+// DiscoverServers listens for Servers announcing themselves on the local network for
+// timeout and returns every Game heard from
+func DiscoverServers(timeout time.Duration) ([]ServerAnnouncement, error) {
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: DISCOVERY_PORT})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return listenForServers(conn, timeout), nil
+}
+
+// listenForServers collects the announcements that arrive on conn within timeout, once
+// for each Server however often it announces itself
+func listenForServers(conn *net.UDPConn, timeout time.Duration) []ServerAnnouncement {
+
+	var servers []ServerAnnouncement
+	heard := make(map[string]bool)
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	packet := make([]byte, DISCOVERY_MAX_PACKET)
+
+	for {
+		n, from, err := conn.ReadFromUDP(packet)
+		if err != nil {
+			return servers
+		}
+
+		var announcement ServerAnnouncement
+		if json.Unmarshal(packet[:n], &announcement) != nil || announcement.Game != DISCOVERY_GAME {
+			continue
+		}
+
+		announcement.Address = ServerAddress(from.IP.String(), announcement.Port)
+		if !heard[announcement.Address] {
+			heard[announcement.Address] = true
+			servers = append(servers, announcement)
+		}
+	}
+}
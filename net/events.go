@@ -0,0 +1,102 @@
+package net
+
+import (
+	"sync"
+	"time"
+	game "github.com/jason-meredith/warships/game"
+)
+
+/*********************************************************
+ *														 *
+ *                   	  Warships						 *
+ *					   Jason Meredith					 *
+ *														 *
+ *	DATE:		October 18, 2026						 *
+ *	FILE: 		events.go								 *
+ *	PURPOSE:	Pushes Events to Clients as they		 *
+ *				happen. Clients hold a Subscribe call	 *
+ *				open and the Server answers it as soon	 *
+ *				as there is something for them.			 *
+ *				 										 *
+ *														 *
+ *********************************************************/
+
+const (
+	// SUBSCRIBE_TIMEOUT is the longest a Subscribe call is held open with nothing to send
+	SUBSCRIBE_TIMEOUT = 30 * time.Second
+)
+
+// Notifier wakes everything waiting on it whenever the Game changes. Waiters take the
+// Changed channel before checking for news, so a change made while they are checking
+// still wakes them
+type Notifier struct {
+	mutex	sync.Mutex
+	changed	chan struct{}
+}
+
+// NewNotifier creates a Notifier with nothing waiting on it
+func NewNotifier() *Notifier {
+	return &Notifier{changed: make(chan struct{})}
+}
+
+// Changed returns a channel that is closed the next time Notify is called
+func (notifier *Notifier) Changed() <-chan struct{} {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+
+	return notifier.changed
+}
+
+// Notify wakes everything waiting on the Notifier
+func (notifier *Notifier) Notify() {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+
+	close(notifier.changed)
+	notifier.changed = make(chan struct{})
+}
+
+// Subscribe waits for Events, chat messages or announcements for the Player and returns
+// them as soon as there are any. If nothing happens within SUBSCRIBE_TIMEOUT it returns an
+// empty response and the Client calls again
+func (t *Server) Subscribe(args ClientCommand, response *string) error {
+
+	timeout := time.After(SUBSCRIBE_TIMEOUT)
+
+	for {
+		changed := t.notifier.Changed()
+
+		if err := t.runPoll(args, response, t.subscribe); err != nil || *response != "" {
+			return err
+		}
+
+		// Nothing yet, wait for the next change and check again
+		select {
+		case <-changed:
+		case <-timeout:
+			return nil
+		}
+	}
+}
+
+// subscribe sends a Client every Event and chat message it hasn't been sent yet, one per line
+func (t *Server) subscribe(player *game.Player, args ClientCommand, response *string) error {
+
+	// Each session keeps its own place, so every Client the Player has connected is sent everything
+	session, err := t.sessions.lookup(args.Token, false)
+	if err != nil {
+		return err
+	}
+
+	output := ""
+	for _, event := range t.game.UnseenEvents(player, &session.EventsSeen) {
+		output += event.String() + "\n"
+	}
+	for _, message := range t.chatRoom.Unread(player, &session.ChatSeen) {
+		output += message.String() + "\n"
+	}
+
+	*response = output
+
+	return nil
+}
@@ -0,0 +1,207 @@
+package net
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/rpc"
+	"strings"
+)
+
+/*********************************************************
+ *														 *
+ *                   	  Warships						 *
+ *					   Jason Meredith					 *
+ *														 *
+ *	DATE:		October 18, 2026						 *
+ *	FILE: 		gateway.go								 *
+ *	PURPOSE:	Lets browsers play over a WebSocket.	 *
+ *				Commands arrive as JSON and are run		 *
+ *				through the same RPCs the Go client		 *
+ *				calls, Events are pushed back as JSON.	 *
+ *				 										 *
+ *														 *
+ *********************************************************/
+
+// WEBSOCKET_PATH is where WebSocket Clients connect, next to the RPC handler
+const WEBSOCKET_PATH = "/ws"
+
+// GatewayMessage types, what a message sent to a WebSocket Client is
+const (
+	GATEWAY_JOINED   = "joined"
+	GATEWAY_RESPONSE = "response"
+	GATEWAY_ERROR    = "error"
+	GATEWAY_EVENT    = "event"
+)
+
+// GatewayRequest is a message from a WebSocket Client. It either logs in with Login or
+// sends a command in Fields, split up just as the Go client splits what is typed in,
+// ex: {"id": 2, "fields": ["target", "2", "G7"]}
+type GatewayRequest struct {
+	// Sent back with the reply so the Client can match them up
+	Id		int					`json:"id"`
+
+	Login	*LoginCredentials	`json:"login,omitempty"`
+	Fields	[]string			`json:"fields,omitempty"`
+}
+
+// GatewayMessage is a message to a WebSocket Client, either the reply to a GatewayRequest
+// or an Event pushed by the Server
+type GatewayMessage struct {
+	Type	string			`json:"type"`
+	Id		int				`json:"id,omitempty"`
+	Text	string			`json:"text,omitempty"`
+
+	// Commands with a typed reply send it here as well as rendered in Text
+	Reply	interface{}		`json:"reply,omitempty"`
+
+	// Sent back after logging in
+	Join	*JoinDetails	`json:"join,omitempty"`
+}
+
+// websocketHandler accepts WebSocket connections and runs a gateway on each
+type websocketHandler struct {
+	server *Server
+}
+
+// gateway passes commands from one WebSocket Client to the Server's RPCs and pushes
+// Events back. The RPCs are called over an in-memory connection, so browsers get exactly
+// the commands Go clients do
+type gateway struct {
+	ws		*WebSocket
+	client	*rpc.Client
+
+	// Session token from logging in, only touched by the reading goroutine
+	token	string
+}
+
+// ServeHTTP completes the WebSocket handshake and serves the connection until it closes
+func (handler websocketHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	ws, err := UpgradeWebSocket(w, req)
+	if err != nil {
+		timeStamp()
+		fmt.Printf("Error accepting WebSocket from %v: %v\n", req.RemoteAddr, err)
+		return
+	}
+	defer ws.Close()
+
+	serverEnd, clientEnd := net.Pipe()
+	go handler.server.serveConn(serverEnd, req.RemoteAddr)
+
+	client := rpc.NewClient(clientEnd)
+	defer client.Close()
+
+	timeStamp()
+	fmt.Printf("WebSocket Client connected\n")
+	fmt.Printf("\t-Address: %v\n", req.RemoteAddr)
+
+	(&gateway{ws: ws, client: client}).serve()
+
+	timeStamp()
+	fmt.Printf("WebSocket Client disconnected\n")
+	fmt.Printf("\t-Address: %v\n", req.RemoteAddr)
+}
+
+// serve answers each GatewayRequest in turn until the WebSocket closes
+func (g *gateway) serve() {
+	for {
+		data, err := g.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var request GatewayRequest
+		if err := json.Unmarshal(data, &request); err != nil {
+			g.send(GatewayMessage{Type: GATEWAY_ERROR, Text: "invalid request: " + err.Error()})
+			continue
+		}
+
+		g.send(g.handle(request))
+	}
+}
+
+// handle runs a single GatewayRequest and returns the reply
+func (g *gateway) handle(request GatewayRequest) GatewayMessage {
+
+	fail := func(err error) GatewayMessage {
+		return GatewayMessage{Type: GATEWAY_ERROR, Id: request.Id, Text: err.Error()}
+	}
+
+	if request.Login != nil {
+
+		// Events are pushed for the session the connection logged in with, so it can't
+		// switch to another one part way through
+		if g.token != "" {
+			return fail(errors.New("already logged in, open a new connection to log in again"))
+		}
+
+		// The gateway speaks the current protocol for its Clients, they only need to send a
+		// version to have it checked
+		if request.Login.ProtocolVersion == 0 {
+			request.Login.ProtocolVersion = PROTOCOL_VERSION
+		}
+
+		var details JoinDetails
+		if err := g.client.Call("Server.JoinGame", request.Login, &details); err != nil {
+			return fail(err)
+		}
+
+		g.token = details.Token
+		go g.pushEvents(details.Token)
+
+		return GatewayMessage{Type: GATEWAY_JOINED, Id: request.Id, Join: &details}
+	}
+
+	if len(request.Fields) == 0 {
+		return fail(errors.New("request needs either login or fields"))
+	}
+
+	rpcCall, valid := GetCommand(request.Fields[0])
+	if !valid {
+		return fail(fmt.Errorf("command '%v' not found", request.Fields[0]))
+	}
+
+	reply := NewReply(rpcCall)
+	command := ClientCommand{Token: g.token, Fields: request.Fields}
+	if err := g.client.Call(rpcCall, &command, reply); err != nil {
+		return fail(err)
+	}
+
+	message := GatewayMessage{Type: GATEWAY_RESPONSE, Id: request.Id, Text: Render(reply)}
+	if _, isString := reply.(*string); !isString {
+		message.Reply = reply
+	}
+
+	return message
+}
+
+// pushEvents holds a Subscribe call open for the session and sends each line that comes
+// back to the Client as its own event. Stops once the session or the connection ends
+func (g *gateway) pushEvents(token string) {
+	for {
+		var response string
+		err := g.client.Call("Server.Subscribe", &ClientCommand{Token: token}, &response)
+		if err != nil {
+			return
+		}
+
+		for _, line := range strings.Split(response, "\n") {
+			if line != "" {
+				g.send(GatewayMessage{Type: GATEWAY_EVENT, Text: line})
+			}
+		}
+	}
+}
+
+// send writes a GatewayMessage to the Client as JSON. Write errors are left for the
+// reading goroutine to find when the connection closes
+func (g *gateway) send(message GatewayMessage) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	g.ws.WriteMessage(data)
+}
@@ -0,0 +1,291 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	game "github.com/jason-meredith/warships/game"
+)
+
+/*********************************************************
+ *														 *
+ *                   	  Warships						 *
+ *					   Jason Meredith					 *
+ *														 *
+ *	DATE:		October 18, 2026						 *
+ *	FILE: 		moderation.go							 *
+ *	PURPOSE:	Chat moderation. Players can scroll back *
+ *				through a channel, and mute or ignore	 *
+ *				other Players. Admins can silence a		 *
+ *				Player for a while, everyone is rate	 *
+ *				limited and every message is logged.	 *
+ *				 										 *
+ *														 *
+ *********************************************************/
+
+const (
+	// DEFAULT_CHAT_LOG is where chat is logged unless the server says otherwise
+	DEFAULT_CHAT_LOG = "warships-chat.log"
+
+	// A Player can send at most CHAT_RATE_LIMIT messages every CHAT_RATE_WINDOW
+	CHAT_RATE_LIMIT  = 5
+	CHAT_RATE_WINDOW = 10 * time.Second
+
+	// CHAT_HISTORY_DEFAULT is how many messages history shows if not told otherwise
+	CHAT_HISTORY_DEFAULT = 20
+)
+
+// OpenLog starts writing every message to a file, adding to the end of it if it exists
+func (room *ChatRoom) OpenLog(path string) error {
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	room.mutex.Lock()
+	defer room.mutex.Unlock()
+
+	room.log = file
+
+	return nil
+}
+
+// CanSend checks a Player isn't silenced or sending too quickly, and if not counts the
+// message towards their rate limit
+func (room *ChatRoom) CanSend(player *game.Player) error {
+	room.mutex.Lock()
+	defer room.mutex.Unlock()
+
+	if until, exists := room.silenced[player.Username]; exists {
+		if time.Now().Before(until) {
+			return fmt.Errorf("you have been silenced by an admin for another %v",
+				time.Until(until).Round(time.Second))
+		}
+		delete(room.silenced, player.Username)
+	}
+
+	// Only keep the messages sent inside the window
+	var recent []time.Time
+	for _, sent := range room.sent[player] {
+		if time.Since(sent) < CHAT_RATE_WINDOW {
+			recent = append(recent, sent)
+		}
+	}
+
+	if len(recent) >= CHAT_RATE_LIMIT {
+		room.sent[player] = recent
+		return fmt.Errorf("you are sending messages too quickly, the limit is %v every %v",
+			CHAT_RATE_LIMIT, CHAT_RATE_WINDOW)
+	}
+
+	room.sent[player] = append(recent, time.Now())
+
+	return nil
+}
+
+// Silence stops a username sending messages for a while, a duration of 0 lifts the silence
+func (room *ChatRoom) Silence(username string, duration time.Duration) {
+	room.mutex.Lock()
+	defer room.mutex.Unlock()
+
+	if duration <= 0 {
+		delete(room.silenced, username)
+	} else {
+		room.silenced[username] = time.Now().Add(duration)
+	}
+}
+
+// ToggleMute mutes a username for a Player, or unmutes them if they're already muted.
+// Returns true if the username is now muted
+func (room *ChatRoom) ToggleMute(player *game.Player, username string) bool {
+	room.mutex.Lock()
+	defer room.mutex.Unlock()
+
+	return toggle(room.muted, player, username)
+}
+
+// ToggleIgnore ignores a username for a Player, or stops ignoring them if they already
+// are. Returns true if the username is now ignored
+func (room *ChatRoom) ToggleIgnore(player *game.Player, username string) bool {
+	room.mutex.Lock()
+	defer room.mutex.Unlock()
+
+	return toggle(room.ignored, player, username)
+}
+
+// Ignoring returns true if a Player is ignoring a username
+func (room *ChatRoom) Ignoring(player *game.Player, username string) bool {
+	room.mutex.Lock()
+	defer room.mutex.Unlock()
+
+	return room.ignored[player][username]
+}
+
+// History returns up to the last n messages of a channel the Player can read, oldest first
+func (room *ChatRoom) History(player *game.Player, channel string, n int) []*ChatMessage {
+	room.mutex.Lock()
+	defer room.mutex.Unlock()
+
+	var history []*ChatMessage
+	for _, message := range room.channels[channel] {
+		if canRead(player, message) && !room.hidden(player, message) {
+			history = append(history, message)
+		}
+	}
+
+	if len(history) > n {
+		history = history[len(history)-n:]
+	}
+
+	return history
+}
+
+// hidden returns true if the Player has muted or ignored the sender of a message, the
+// mutex must already be held
+func (room *ChatRoom) hidden(player *game.Player, message *ChatMessage) bool {
+	return room.muted[player][message.From] || room.ignored[player][message.From]
+}
+
+// toggle flips a username in a Player's set, returning true if it is now in the set
+func toggle(sets map[*game.Player]map[string]bool, player *game.Player, username string) bool {
+
+	if sets[player] == nil {
+		sets[player] = make(map[string]bool)
+	}
+
+	if sets[player][username] {
+		delete(sets[player], username)
+		return false
+	}
+
+	sets[player][username] = true
+	return true
+}
+
+// history shows the last messages of a channel: history [all|team|@username] [n]
+func (t *Server) history(player *game.Player, args ClientCommand, response *string) error {
+
+	channel := CHAT_ALL
+	n := CHAT_HISTORY_DEFAULT
+
+	fields := args.Fields[1:]
+
+	// The number of messages can come on its own or after the channel
+	if len(fields) > 0 {
+		if _, err := strconv.Atoi(fields[0]); err != nil {
+			channel, fields = fields[0], fields[1:]
+		}
+	}
+
+	if len(fields) > 0 {
+		count, err := strconv.Atoi(fields[0])
+		if err != nil || count < 1 {
+			return errors.New("number of messages invalid: history [all|team|@username] [n]")
+		}
+		n = count
+	}
+
+	switch {
+	case channel == CHAT_ALL:
+	case channel == "team":
+		if player.Spectator {
+			return ErrSpectator
+		}
+		channel = TeamChannel(player.Team)
+	case strings.HasPrefix(channel, "@") && len(channel) > 1:
+		channel = PrivateChannel(player.Username, channel[1:])
+	default:
+		return errors.New("channel invalid: history [all|team|@username] [n]")
+	}
+
+	output := ""
+	for _, message := range t.chatRoom.History(player, channel, n) {
+		output += fmt.Sprintf("%v %v\n", message.Time.Format("15:04:05"), message)
+	}
+
+	if output == "" {
+		output = "No messages\n"
+	}
+
+	*response = output
+
+	return nil
+}
+
+// mute hides, or stops hiding, another Player's messages: mute <username>
+func (t *Server) mute(player *game.Player, args ClientCommand, response *string) error {
+
+	if len(args.Fields) < 2 {
+		return errors.New("not enough arguments to perform mute command: mute <username>")
+	}
+
+	username := args.Fields[1]
+
+	if t.chatRoom.ToggleMute(player, username) {
+		*response = fmt.Sprintf("Muted %v, run 'mute %v' again to unmute", username, username)
+	} else {
+		*response = fmt.Sprintf("Unmuted %v", username)
+	}
+
+	return nil
+}
+
+// ignore hides another Player's messages and stops them messaging you privately,
+// or undoes it: ignore <username>
+func (t *Server) ignore(player *game.Player, args ClientCommand, response *string) error {
+
+	if len(args.Fields) < 2 {
+		return errors.New("not enough arguments to perform ignore command: ignore <username>")
+	}
+
+	username := args.Fields[1]
+
+	if t.chatRoom.ToggleIgnore(player, username) {
+		*response = fmt.Sprintf("Ignoring %v, run 'ignore %v' again to stop", username, username)
+	} else {
+		*response = fmt.Sprintf("No longer ignoring %v", username)
+	}
+
+	return nil
+}
+
+// silence stops a Player sending chat messages for a while: silence <username> <duration>.
+// A duration of 0 lifts the silence
+func (t *Server) silence(admin *game.Player, args ClientCommand, response *string) error {
+
+	if len(args.Fields) < 3 {
+		return errors.New("not enough arguments to perform silence command: silence <username> <duration>")
+	}
+
+	username := args.Fields[1]
+
+	if t.game.GetPlayerByUsername(username) == nil {
+		return errors.New("there is no player with that username")
+	}
+
+	duration, err := time.ParseDuration(args.Fields[2])
+	if err != nil || duration < 0 {
+		return errors.New("duration invalid, use a duration such as 10m or 1h: silence <username> <duration>")
+	}
+
+	t.chatRoom.Silence(username, duration)
+
+	if duration == 0 {
+		*response = fmt.Sprintf("%v can chat again", username)
+	} else {
+		*response = fmt.Sprintf("Silenced %v for %v", username, duration)
+		t.game.Announce("%v has been silenced for %v", username, duration)
+	}
+
+	timeStamp()
+	fmt.Printf("Player Silenced\n")
+	fmt.Printf("\t-Admin: %v (%v)\n", admin.Username, admin.Id)
+	fmt.Printf("\t-Player: %v\n", username)
+	fmt.Printf("\t-Duration: %v\n", duration)
+
+	return nil
+}
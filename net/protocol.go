@@ -0,0 +1,113 @@
+package net
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+/*********************************************************
+ *														 *
+ *                   	  Warships						 *
+ *					   Jason Meredith					 *
+ *														 *
+ *	DATE:		October 18, 2026						 *
+ *	FILE: 		protocol.go								 *
+ *	PURPOSE:	Protocol version handshake. Client and	 *
+ *				Server swap their protocol version and	 *
+ *				the commands they support when a		 *
+ *				Player joins.							 *
+ *				 										 *
+ *														 *
+ *********************************************************/
+
+const (
+	// PROTOCOL_VERSION is the version of the RPC protocol this build speaks. Bump it
+	// whenever a change means older builds can no longer talk to this one
+	PROTOCOL_VERSION = 1
+
+	// MIN_PROTOCOL_VERSION is the oldest version this build will still talk to
+	MIN_PROTOCOL_VERSION = 1
+)
+
+// IncompatibleVersion is returned when one side of a connection speaks a protocol version
+// older than the other side supports
+type IncompatibleVersion struct {
+	// Version spoken by the out of date side
+	Version	int
+
+	// True if the Server is out of date, false if the Client is
+	Server	bool
+}
+
+// Error tells the user which side needs updating
+func (err *IncompatibleVersion) Error() string {
+	if err.Server {
+		return fmt.Sprintf("the server is out of date (protocol version %v, version %v or newer needed), " +
+			"ask its host to update Warships", err.Version, MIN_PROTOCOL_VERSION)
+	}
+	return fmt.Sprintf("your client is out of date (protocol version %v, version %v or newer needed), " +
+		"update Warships and try again", err.Version, MIN_PROTOCOL_VERSION)
+}
+
+// checkProtocol returns an IncompatibleVersion if the other side's protocol version is too old
+func checkProtocol(version int, server bool) error {
+	if version < MIN_PROTOCOL_VERSION {
+		return &IncompatibleVersion{Version: version, Server: server}
+	}
+	return nil
+}
+
+// errorType is the type every RPC call returns
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// ServerCommands lists the RPC calls the Server supports, such as "Server.Target"
+func ServerCommands() []string {
+
+	var commands []string
+
+	serverType := reflect.TypeOf(&Server{})
+	for i := 0; i < serverType.NumMethod(); i++ {
+		method := serverType.Method(i)
+
+		// RPC calls take the Server, the arguments and a pointer to the reply
+		if method.Type.NumIn() != 3 || method.Type.In(2).Kind() != reflect.Ptr ||
+			method.Type.NumOut() != 1 || method.Type.Out(0) != errorType {
+			continue
+		}
+
+		commands = append(commands, "Server."+method.Name)
+	}
+
+	return commands
+}
+
+// ClientCommands lists the RPC calls the Client knows how to send
+func ClientCommands() []string {
+
+	commands := []string{"Server.JoinGame", "Server.Chat", "Server.Subscribe"}
+	for _, rpcCall := range commandMap() {
+		commands = append(commands, rpcCall)
+	}
+
+	sort.Strings(commands)
+	return commands
+}
+
+// missingCommands returns the RPC calls in wanted that aren't in supported
+func missingCommands(wanted, supported []string) []string {
+
+	have := make(map[string]bool)
+	for _, rpcCall := range supported {
+		have[rpcCall] = true
+	}
+
+	var missing []string
+	for _, rpcCall := range wanted {
+		if !have[rpcCall] {
+			missing = append(missing, rpcCall)
+		}
+	}
+
+	return missing
+}
@@ -0,0 +1,279 @@
+package net
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	base26 "github.com/jason-meredith/warships/base26"
+	game "github.com/jason-meredith/warships/game"
+)
+
+/*********************************************************
+ *														 *
+ *                   	  Warships						 *
+ *					   Jason Meredith					 *
+ *														 *
+ *	DATE:		October 18, 2026						 *
+ *	FILE: 		replies.go								 *
+ *	PURPOSE:	Typed replies for the commands that		 *
+ *				return game data, and how the Client	 *
+ *				renders them. Bots and other user		 *
+ *				interfaces can use the data directly.	 *
+ *				 										 *
+ *														 *
+ *********************************************************/
+
+// Renderer is a typed reply the Client can turn into text for the user
+type Renderer interface {
+	Render() string
+}
+
+// Reply is part of every typed reply
+type Reply struct {
+	// Announcements made since the Player's last command, one per line
+	Announcements	string	`json:"announcements,omitempty"`
+}
+
+// MapReply is a board, either a Team's own map or its radar of another Team
+type MapReply struct {
+	Reply
+
+	// Team the board belongs to, and for radar the Team being watched
+	Team	string	`json:"team"`
+	Target	string	`json:"target,omitempty"`
+
+	Size	uint8			`json:"size"`
+	Cells	[][]game.CellState	`json:"cells"`
+}
+
+// ShotReply is the result of firing a shot
+type ShotReply struct {
+	Reply
+
+	Team	string			`json:"team"`
+	Target	string			`json:"target"`
+	Result	game.ShotResult	`json:"result"`
+
+	// The Player's hit streak and points after the shot
+	Streak	int	`json:"streak"`
+	Points	int	`json:"points"`
+}
+
+// DeployReply is a newly deployed Ship and the deployment points left to the Team
+type DeployReply struct {
+	Reply
+
+	Location			string				`json:"location"`
+	Size				uint8				`json:"size"`
+	Orientation			game.Orientation	`json:"orientation"`
+	DeploymentPoints	int					`json:"deploymentPoints"`
+}
+
+// PointsReply is the deployment points a Team has
+type PointsReply struct {
+	Reply
+
+	DeploymentPoints	int	`json:"deploymentPoints"`
+}
+
+// TeamSummary is a Team as shown in a list of Teams
+type TeamSummary struct {
+	Id		int		`json:"id"`
+	Name	string	`json:"name"`
+
+	// True for the Team of the Player who asked
+	Yours	bool	`json:"yours"`
+
+	Players	int	`json:"players"`
+	Active	int	`json:"active"`
+
+	// Ships are hidden from spectators watching on a delay
+	Ships		int		`json:"ships"`
+	ShipsHidden	bool	`json:"shipsHidden"`
+}
+
+// TeamsReply lists every Team in the Game
+type TeamsReply struct {
+	Reply
+
+	Teams	[]TeamSummary	`json:"teams"`
+}
+
+// PlayerSummary is a Player as shown in a list of Players
+type PlayerSummary struct {
+	Username	string	`json:"username"`
+
+	// Difficulty of bot Players, empty for people
+	Bot			string	`json:"bot,omitempty"`
+
+	// Points are only shown to a Player's own Team and to spectators who aren't
+	// watching on a delay
+	Points			int		`json:"points"`
+	PointsHidden	bool	`json:"pointsHidden"`
+
+	// Online, AFK or departed, see game.Presence
+	Status		string	`json:"status"`
+}
+
+// TeamRoster is a Team and the Players on it
+type TeamRoster struct {
+	TeamSummary
+
+	Members	[]PlayerSummary	`json:"members"`
+}
+
+// PlayersReply lists the Players on every Team, or on a single Team if one was asked for
+type PlayersReply struct {
+	Reply
+
+	// True if a single Team was asked for
+	Selected	bool	`json:"selected"`
+
+	Teams		[]TeamRoster	`json:"teams"`
+	Spectators	[]PlayerSummary	`json:"spectators,omitempty"`
+}
+
+// NewReply returns a pointer to an empty reply of the type an RPC answers with: one of the
+// typed replies above, or a string for commands that just return a message
+func NewReply(rpcCall string) interface{} {
+
+	method, exists := reflect.TypeOf(&Server{}).MethodByName(strings.TrimPrefix(rpcCall, "Server."))
+	if !exists || method.Type.NumIn() != 3 {
+		return new(string)
+	}
+
+	// Arguments are the Server, the ClientCommand and the reply
+	return reflect.New(method.Type.In(2).Elem()).Interface()
+}
+
+// Render returns the text shown to the user for a reply
+func Render(reply interface{}) string {
+	switch reply := reply.(type) {
+	case Renderer:
+		return reply.Render()
+	case *string:
+		return *reply
+	}
+	return fmt.Sprint(reply)
+}
+
+// PrintMap draws a board with its column letters and row numbers, asking icon what to put
+// in each square
+func PrintMap(boardSize uint8, icon func(x, y int) string) string {
+	// Produce a string and put in response
+	output := "    "
+
+	// Top row
+	for x := 0; x <= int(boardSize - 1); x++ {
+		output += fmt.Sprintf("%-2v", base26.ConvertToBase26(x))
+	}
+	output += "\n"
+	for y:= 0; y < int(boardSize); y++ {
+		output += fmt.Sprintf("%3v ", strconv.Itoa(y))
+		for x:= 0; x < int(boardSize); x++ {
+			output += icon(x, y)
+		}
+		output += "\n"
+	}
+
+	return output
+}
+
+// Render draws the board
+func (reply *MapReply) Render() string {
+	return reply.Announcements + PrintMap(reply.Size, func(x, y int) string {
+		return reply.Cells[x][y].Icon()
+	})
+}
+
+// Render describes how the shot went
+func (reply *ShotReply) Render() string {
+
+	output := reply.Announcements
+
+	switch reply.Result {
+	case game.HIT:
+		output += "Shot confirmed HIT!\n"
+		output += fmt.Sprintf("%v hit streak\n", reply.Streak)
+	case game.REPEAT_HIT:
+		output += "Shot confirmed HIT but no further damage inflicted!\n"
+	case game.MISS:
+		output += "Shot confirmed MISS!\n"
+	case game.SINK:
+		output += "Shot confirmed HIT... enemy ship SUNK!\n"
+	}
+
+	return output
+}
+
+// Render confirms the Ship was deployed
+func (reply *DeployReply) Render() string {
+	return reply.Announcements + fmt.Sprintf("Ship deployed - %v deployment points remaining", reply.DeploymentPoints)
+}
+
+// Render shows the Team's deployment points
+func (reply *PointsReply) Render() string {
+	return reply.Announcements + fmt.Sprintf("Your team has %v deployment points", reply.DeploymentPoints)
+}
+
+// Render lists the Teams, with a * in front of the Player's own Team
+func (reply *TeamsReply) Render() string {
+
+	output := reply.Announcements
+
+	for _, team := range reply.Teams {
+		strId := strconv.Itoa(team.Id)
+		if team.Yours {
+			strId = "*" + strId
+		}
+
+		output += fmt.Sprintf("%3v:\t%v\n", strId, team.Name)
+	}
+
+	return output
+}
+
+// Render lists the Players on each Team and then the spectators
+func (reply *PlayersReply) Render() string {
+
+	output := reply.Announcements
+
+	for _, team := range reply.Teams {
+		if reply.Selected {
+			output += fmt.Sprintf("\n%v [ %v player(s), %v active ]\n", team.Name, team.Players, team.Active)
+			output += fmt.Sprintf("%8v %-30v %v\n", "Points", "Username", "Status")
+		} else {
+			output += fmt.Sprintf("Team %v: %v\n", team.Id, team.Name)
+		}
+
+		for _, member := range team.Members {
+			output += member.render()
+		}
+	}
+
+	if len(reply.Spectators) > 0 {
+		output += "Spectators:\n"
+		for _, spectator := range reply.Spectators {
+			output += fmt.Sprintf("%8v %-30v %v\n", "", spectator.Username, spectator.Status)
+		}
+	}
+
+	return output
+}
+
+// render shows a single line of a Player list
+func (member PlayerSummary) render() string {
+
+	var points interface{} = member.Points
+	if member.PointsHidden {
+		points = "?"
+	}
+
+	name := member.Username
+	if member.Bot != "" {
+		name = fmt.Sprintf("%v [%v bot]", member.Username, member.Bot)
+	}
+
+	return fmt.Sprintf("%8v %-30v %v\n", points, name, member.Status)
+}
@@ -1,15 +1,18 @@
 package net
 
 import (
+	"crypto/subtle"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/rpc"
 	"os"
 	"strconv"
+	"strings"
 	"time"
-	base26 "github.com/jason-meredith/warships/base26"
 	game "github.com/jason-meredith/warships/game"
 )
 
@@ -44,41 +47,138 @@ import (
 // and the actual Game
 type Server struct {
 	//Test 	int
-	game	*game.Game
+	game		*game.Game
+	sessions	*SessionStore
+	chatRoom	*ChatRoom
+
+	// Wakes Clients waiting on Subscribe whenever the Game changes
+	notifier	*Notifier
+
+	// Remote address of the connection this copy of the Server is serving, see forConnection
+	address		string
 }
 
 // LoginCredentials is the Username/Password combo passed by the client when
-// attempting to log in
+// attempting to log in, along with the server password if the Game has one
 type LoginCredentials struct {
-	Username	string
-	Password	string
+	Username		string	`json:"username"`
+	Password		string	`json:"password"`
+	ServerPassword	string	`json:"serverPassword"`
+
+	// Invite code for the Team the Player wants to join, if they have one
+	TeamCode		string	`json:"teamCode"`
+
+	// If true the Player joins as a spectator instead of joining a Team
+	Spectator		bool	`json:"spectator"`
+
+	// Protocol version the Client speaks and the RPC calls it knows, see ClientCommands
+	ProtocolVersion	int			`json:"protocolVersion"`
+	Commands		[]string	`json:"commands,omitempty"`
 }
 
 // JoinDetails is information sent back to the Client after a successful login
-// telling the Client program their PlayerID and the team they've been assigned
+// telling the Client program their PlayerID, the team they've been assigned and
+// the session token that must be sent along with every command
 type JoinDetails struct {
-	PlayerId 	string
-	TeamName 	string
+	PlayerId 	string	`json:"playerId"`
+	TeamName 	string	`json:"teamName"`
+	Token		string	`json:"token"`
+
+	// Protocol version the Server speaks and the RPC calls it supports, see ServerCommands
+	ProtocolVersion	int			`json:"protocolVersion"`
+	Commands		[]string	`json:"commands"`
 }
 
-// RPC_PORT is the TCP port that the server listens to
+// RPC_PORT is the TCP port that the server listens to unless the Game sets its own Port
 const RPC_PORT = 51832
 
+// ParsePort converts a port number typed in by the user, an empty string meaning RPC_PORT
+func ParsePort(value string) (uint16, error) {
+
+	if value == "" {
+		return RPC_PORT, nil
+	}
+
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, errors.New("port invalid, choose a number from 1 to 65535")
+	}
+
+	return uint16(port), nil
+}
+
 // StartGameServer creates the Server using a new Game, sets up the RPC Listener
 // and handles all incoming Client requests.
 func StartGameServer(newGame *game.Game) {
 
+	if newGame.Port == 0 {
+		newGame.Port = RPC_PORT
+	}
+
+	// Games without a name are named after the machine they run on
+	if newGame.Name == "" {
+		newGame.Name, _ = os.Hostname()
+		if newGame.Name == "" {
+			newGame.Name = "Warships"
+		}
+	}
 
 	timeStamp()
 	fmt.Println("Starting Server")
+	fmt.Printf("\t-Name: %v\n", newGame.Name)
 	fmt.Printf("\t-Listening on port %d\n", newGame.Port)
+	fmt.Printf("\t-WebSocket Path: %v\n", WEBSOCKET_PATH)
+	fmt.Printf("\t-JSON API Path: %v\n", API_PATH)
+	fmt.Printf("\t-TLS: %v\n", newGame.TLS)
+	fmt.Printf("\t-LAN Discovery: %v\n", newGame.LANDiscovery)
 	fmt.Printf("\t-Max Players: %d\n", newGame.MaxPlayers)
+	fmt.Printf("\t-Queue When Full: %v\n", newGame.QueueWhenFull)
+	fmt.Printf("\t-Password Protected: %v\n", newGame.Password != "")
 	fmt.Printf("\t-Ship Limit: %d\n", newGame.ShipLimit)
 	fmt.Printf("\t-Board Size: %d\n", newGame.BoardSize)
+	fmt.Printf("\t-Max Imbalance: 1:%d\n", newGame.MaxImbalance)
+	fmt.Printf("\t-Switch Cooldown: %v\n", newGame.SwitchCooldown)
+	fmt.Printf("\t-Alliance Cooldown: %v\n", newGame.AllianceCooldown)
+	fmt.Printf("\t-Share Ally Radar: %v\n", newGame.ShareAllyRadar)
+	fmt.Printf("\t-Session Timeout: %v\n", newGame.SessionTimeout)
+	fmt.Printf("\t-AFK Timeout: %v\n", newGame.AfkTimeout)
+	fmt.Printf("\t-Departed Timeout: %v\n", newGame.DepartedTimeout)
+	fmt.Printf("\t-Ban List: %v\n", newGame.BanFile)
+	fmt.Printf("\t-Player Registry: %v\n", newGame.RegistryFile)
+	fmt.Printf("\t-Chat Log: %v\n", newGame.ChatLogFile)
+	fmt.Printf("\t-Spectator Delay: %v\n", newGame.SpectatorDelay)
 
 	// Create the Server object using the Game generated and passed to us by the CLI
 	server := new(Server)
 	server.game = newGame
+	server.sessions = NewSessionStore(newGame.SessionTimeout)
+	server.chatRoom = NewChatRoom()
+	server.notifier = NewNotifier()
+
+	// Keep a record of chat for settling disputes
+	if newGame.ChatLogFile != "" {
+		if err := server.chatRoom.OpenLog(newGame.ChatLogFile); err != nil {
+			fmt.Println("Error opening chat log: " + err.Error())
+			fmt.Println("Chat will not be logged")
+		}
+	}
+
+	// Load the bans from previous runs of the Server
+	bans, err := game.LoadBanList(newGame.BanFile)
+	if err != nil {
+		fmt.Println("Error loading ban list: " + err.Error())
+		fmt.Println("Starting with an empty ban list")
+	}
+	server.game.Bans = bans
+
+	// Load the accounts of everyone who has played on this server before
+	registry, err := game.LoadRegistry(newGame.RegistryFile)
+	if err != nil {
+		fmt.Println("Error loading player registry: " + err.Error())
+		fmt.Println("Starting with an empty player registry")
+	}
+	server.game.Registry = registry
+
 	server.game.Teams = []*game.Team{}
 	teamA := server.game.NewTeam()
 	teamB := server.game.NewTeam()
@@ -87,41 +187,145 @@ func StartGameServer(newGame *game.Game) {
 	//TODO///////////////////  SHIP TEST DELEEEEETE
 
 
-	teamA.NewShip(5, game.HORIZONTAL, game.Coordinate{2,2})
+	teamA.NewShip(5, game.HORIZONTAL, game.Coordinate{X: 2, Y: 2})
 
-	teamA.NewShip(5, game.VERTICAL, game.Coordinate{2,4})
+	teamA.NewShip(5, game.VERTICAL, game.Coordinate{X: 2, Y: 4})
 
-	teamB.NewShip(5, game.VERTICAL, game.Coordinate{2,2})
-	teamB.NewShip(5, game.HORIZONTAL, game.Coordinate{4,4})
+	teamB.NewShip(5, game.VERTICAL, game.Coordinate{X: 2, Y: 2})
+	teamB.NewShip(5, game.HORIZONTAL, game.Coordinate{X: 4, Y: 4})
 
 
 	//TODO//////////////////////////////////////////
 
 	// Register the server for Remote Procedure Calls
-	rpc.Register(server)
-	rpc.HandleHTTP()
+	http.Handle(rpc.DefaultRPCPath, rpcHandler{server})
+
+	// Browsers send the same commands as JSON over a WebSocket
+	http.Handle(WEBSOCKET_PATH, websocketHandler{server})
+
+	// Other tools use the JSON API
+	http.Handle(API_PATH, apiHandler{server})
 
-	// Listen on the RPC port for incoming commands
-	listener, err := net.Listen("tcp", ":" + strconv.Itoa(RPC_PORT))
+	// Listen on the Game's port for incoming commands
+	port := strconv.Itoa(int(newGame.Port))
+	listener, err := net.Listen("tcp", ":" + port)
 	if err != nil {
-		fmt.Println("Error encountered when starting server... is port " + strconv.Itoa(RPC_PORT) + " open?")
-		fmt.Println("Program will now exit. Try changing the Server Listen Port or freeing port " + strconv.Itoa(RPC_PORT))
+		fmt.Println("Error encountered when starting server... is port " + port + " open?")
+		fmt.Println("Program will now exit. Try changing the Server Listen Port or freeing port " + port)
 		os.Exit(1)
 	}
 
+	// Everything on the port is encrypted when TLS is on, WebSocket and JSON API included
+	if newGame.TLS {
+		cert, created, err := LoadOrCreateCertificate(newGame.CertFile, newGame.KeyFile)
+		if err != nil {
+			fmt.Println("Error loading TLS certificate: " + err.Error())
+			fmt.Println("Program will now exit. Check the certificate and key files or remove both to generate new ones")
+			os.Exit(1)
+		}
+
+		timeStamp()
+		if created {
+			fmt.Println("Generated self-signed TLS certificate")
+		} else {
+			fmt.Println("Loaded TLS certificate")
+		}
+		fmt.Printf("\t-Certificate: %v\n", newGame.CertFile)
+		fmt.Printf("\t-Fingerprint: %v\n", CertificateFingerprint(cert.Certificate[0]))
+
+		listener = tls.NewListener(listener, &tls.Config{Certificates: []tls.Certificate{cert}})
+	}
+
 	go http.Serve(listener, nil)
 
-	// Loop for as long as Game is 'live'
-	for server.game.Live {
-		// Every five seconds give each team a deployment point
+	// Let Players on the local network find the Game
+	if newGame.LANDiscovery {
+		conn, err := net.ListenUDP("udp4", nil)
+		if err != nil {
+			fmt.Println("Error starting LAN discovery: " + err.Error())
+			fmt.Println("The game will not be announced on the local network")
+		} else {
+			go server.advertise(conn)
+		}
+	}
+
+	// Loop for as long as Game is 'live', every five seconds
+	for {
 		time.Sleep(5 * time.Second)
-		for _, team := range server.game.Teams {
-			team.DeploymentPoints++
+		if !server.tick() {
+			break
 		}
 	}
 
 }
 
+// tick moves the Game along between commands: each Team gets a deployment point, bots
+// take their turns and Player accounts are saved. Returns false once the Game is over
+func (t *Server) tick() bool {
+
+	t.game.Lock()
+	defer t.game.Unlock()
+
+	for _, team := range t.game.Teams {
+		team.DeploymentPoints++
+	}
+
+	t.game.RunBots()
+	t.notifier.Notify()
+
+	// Save any changes to Player accounts
+	if err := t.game.Registry.Save(); err != nil {
+		timeStamp()
+		fmt.Printf("Error saving player registry: %v\n", err)
+	}
+
+	return t.game.Live
+}
+
+// rpcHandler accepts RPC connections over HTTP the same way rpc.HandleHTTP does, except
+// that each connection is served by its own copy of the Server which knows the address
+// the connection came from
+type rpcHandler struct {
+	server *Server
+}
+
+// ServeHTTP takes over an HTTP CONNECT request and serves RPCs on the connection
+func (handler rpcHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	if req.Method != "CONNECT" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(w, "405 must CONNECT\n")
+		return
+	}
+
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		timeStamp()
+		fmt.Printf("Error accepting connection from %v: %v\n", req.RemoteAddr, err)
+		return
+	}
+
+	io.WriteString(conn, "HTTP/1.0 200 Connected to Go RPC\n\n")
+
+	handler.server.serveConn(conn, req.RemoteAddr)
+}
+
+// forConnection returns a copy of the Server for serving a single connection from
+// remoteAddr. Everything but the address is shared with the original Server
+func (t *Server) forConnection(remoteAddr string) *Server {
+	connServer := *t
+	connServer.address, _, _ = net.SplitHostPort(remoteAddr)
+	return &connServer
+}
+
+// serveConn serves RPCs sent over a single connection from remoteAddr
+func (t *Server) serveConn(conn io.ReadWriteCloser, remoteAddr string) {
+	rpcServer := rpc.NewServer()
+	rpcServer.RegisterName("Server", t.forConnection(remoteAddr))
+	rpcServer.ServeConn(conn)
+}
+
 // timeStamp is the header for all server log entries
 func timeStamp() {
 	fmt.Printf("\n --- %v ---\n", time.Now())
@@ -130,220 +334,497 @@ func timeStamp() {
 // PrintTeamCounts prints a list of all the Teams and the number of users on each team
 func PrintTeamCounts(game *game.Game) {
 	for _, team := range game.Teams {
-		fmt.Printf("\t%v: %v\n", team.Name, team.NumPlayers)
+		fmt.Printf("\t%v %v: %v\n", team.Id, team.Name, team.NumPlayers)
 	}
 }
 
-// JoinGame joins a Player to the running Server using LoginCredentials.
+// JoinGame joins a Player to the running Server using LoginCredentials. Clients speaking a
+// protocol version that is too old are turned away, others are sent the Server's version and
+// the commands it supports along with their JoinDetails
 func (t *Server) JoinGame(login LoginCredentials, info *JoinDetails) error {
 
-	player, existing, err := t.game.Join(login.Username, login.Password)
+	// Let the Players already in the Game hear about the new arrival
+	defer t.notifier.Notify()
+
+	// Clients from before the handshake send no version at all
+	err := checkProtocol(login.ProtocolVersion, false)
+	if err != nil {
+		return turnAway(login.Username, err)
+	}
+
+	request := game.JoinRequest{
+		Username:       login.Username,
+		Password:       login.Password,
+		ServerPassword: login.ServerPassword,
+		TeamCode:       login.TeamCode,
+		Address:        t.address,
+		Spectator:      login.Spectator,
+	}
+
+	// Password hashing is slow on purpose, so it runs without the Game lock rather than
+	// holding up every other command while it does
+	t.game.Lock()
+	err = t.game.Screen(request)
+	onFile, registered := t.game.PasswordOnFile(login.Username)
+	t.game.Unlock()
+	if err != nil {
+		return turnAway(login.Username, err)
+	}
+
+	credentials, err := game.CheckCredentials(login.Password, onFile, registered)
+	if err != nil {
+		return turnAway(login.Username, err)
+	}
+
+	// Joins run one at a time along with every other command, see game.Lock
+	t.game.Lock()
+	defer t.game.Unlock()
+
+	// A spectator joining as a player leaves their spectator sessions behind
+	spectator := t.game.GetSpectator(login.Username)
+
+	player, existing, err := t.game.Place(request, credentials)
+	if err != nil {
+		return turnAway(login.Username, err)
+	}
+
+	if spectator != nil && !player.Spectator {
+		t.sessions.RevokePlayer(spectator)
+	}
+
+	session, err := t.sessions.Issue(player)
 	if err != nil {
 		return err
 	}
 
+	session.ChatSeen = t.chatRoom.Join(player)
+
+	teamName := "Spectating"
+	if !player.Spectator {
+		teamName = player.Team.Name
+	}
+
 	// Details to send back to Client
 	*info = JoinDetails{
 		player.Id,
-		player.Team.Name,
+		teamName,
+		session.Token,
+		PROTOCOL_VERSION,
+		ServerCommands(),
 	}
 
 	// Print details about this incoming command to the log
 	timeStamp()
-	if !existing {
+	if player.Spectator {
+		fmt.Printf("Spectator connected: %v\n", login.Username)
+	} else if !existing {
 		fmt.Printf("New player connected: %v\n", login.Username)
 	} else {
 		fmt.Printf("Existing player reconnected: %v\n", login.Username)
 	}
 	fmt.Printf("\t-Player ID: %v\n", info.PlayerId)
-	fmt.Printf("\t-Assigned to team %v (%p)\n", info.TeamName, player.Team)
+	fmt.Printf("\t-Address: %v\n", t.address)
+	fmt.Printf("\t-Protocol Version: %v\n", login.ProtocolVersion)
+	if missing := missingCommands(login.Commands, info.Commands); len(missing) > 0 {
+		fmt.Printf("\t-Unsupported Commands: %v\n", strings.Join(missing, ", "))
+	}
+	if !player.Spectator {
+		fmt.Printf("\t-Assigned to team %v (%p)\n", info.TeamName, player.Team)
+	}
 	fmt.Printf("\n\t[Teams]\n")
 	PrintTeamCounts(t.game)
 
 	return err
 }
 
-// EchoTest is used to confirm we are connected and the Client can send commands,
+// turnAway logs a Player who could not join and returns the reason
+func turnAway(username string, err error) error {
+	timeStamp()
+	fmt.Printf("Player turned away: %v\n", username)
+	fmt.Printf("\t-Reason: %v\n", err)
+	return err
+}
+
+//////// CLIENT COMMANDS ///////////
+
+// Every command below is exposed over RPC. Each one passes through run, which checks
+// the session token before the command's handler ever sees it
+
+// EchoTest is used to confirm we are connected and the Client can send commands
+func (t *Server) EchoTest(args ClientCommand, response *string) error {
+	return t.runOpen(args, response, t.echoTest)
+}
+
+// Map shows the calling Player's Team map
+func (t *Server) Map(args ClientCommand, reply *MapReply) error {
+	return t.runOpen(args, &reply.Announcements, func(player *game.Player, args ClientCommand, _ *string) error {
+		return t.showMap(player, args, reply)
+	})
+}
+
+// Radar shows the shots the calling Player's Team has fired on another Team
+func (t *Server) Radar(args ClientCommand, reply *MapReply) error {
+	return t.runOpen(args, &reply.Announcements, func(player *game.Player, args ClientCommand, _ *string) error {
+		return t.showRadar(player, args, reply)
+	})
+}
+
+// Teams lists every Team on the Server
+func (t *Server) Teams(args ClientCommand, reply *TeamsReply) error {
+	return t.runOpen(args, &reply.Announcements, func(player *game.Player, args ClientCommand, _ *string) error {
+		return t.listTeams(player, args, reply)
+	})
+}
+
+// Players lists the Players on one or every Team
+func (t *Server) Players(args ClientCommand, reply *PlayersReply) error {
+	return t.runOpen(args, &reply.Announcements, func(player *game.Player, args ClientCommand, _ *string) error {
+		return t.listPlayers(player, args, reply)
+	})
+}
+
+// Target fires a shot at another Team
+func (t *Server) Target(args ClientCommand, reply *ShotReply) error {
+	return t.run(args, &reply.Announcements, func(player *game.Player, args ClientCommand, _ *string) error {
+		return t.target(player, args, reply)
+	})
+}
+
+// Deploy places a new Ship using the Team's deployment points
+func (t *Server) Deploy(args ClientCommand, reply *DeployReply) error {
+	return t.run(args, &reply.Announcements, func(player *game.Player, args ClientCommand, _ *string) error {
+		return t.deploy(player, args, reply)
+	})
+}
+
+// Switch moves the calling Player to another Team
+func (t *Server) Switch(args ClientCommand, response *string) error {
+	return t.run(args, response, t.switchTeam)
+}
+
+// Points shows the Team's deployment points
+func (t *Server) Points(args ClientCommand, reply *PointsReply) error {
+	return t.run(args, &reply.Announcements, func(player *game.Player, args ClientCommand, _ *string) error {
+		return t.points(player, args, reply)
+	})
+}
+
+// ChatHelp explains how to use chat
+func (t *Server) ChatHelp(args ClientCommand, response *string) error {
+	return t.runOpen(args, response, t.chatHelp)
+}
+
+// Chat sends a chat message to everyone, the Player's Team or another Player
+func (t *Server) Chat(args ClientCommand, response *string) error {
+	return t.run(args, response, t.chat)
+}
+
+// ChatPoll returns the chat messages and announcements the Player hasn't seen yet, for Clients
+// that check in the background rather than Subscribe
+func (t *Server) ChatPoll(args ClientCommand, response *string) error {
+	return t.runPoll(args, response, t.chatPoll)
+}
+
+// History shows the last messages of a chat channel
+func (t *Server) History(args ClientCommand, response *string) error {
+	return t.runOpen(args, response, t.history)
+}
+
+// Mute hides another Player's chat messages
+func (t *Server) Mute(args ClientCommand, response *string) error {
+	return t.runOpen(args, response, t.mute)
+}
+
+// Ignore hides another Player's chat messages and blocks their private messages
+func (t *Server) Ignore(args ClientCommand, response *string) error {
+	return t.runOpen(args, response, t.ignore)
+}
+
+// Rename renames the calling Player's Team
+func (t *Server) Rename(args ClientCommand, response *string) error {
+	return t.run(args, response, t.rename)
+}
+
+// Mutiny starts a new Team with half the deployment points
+func (t *Server) Mutiny(args ClientCommand, response *string) error {
+	return t.run(args, response, t.mutiny)
+}
+
+// Logout ends the calling session
+func (t *Server) Logout(args ClientCommand, response *string) error {
+	return t.runOpen(args, response, t.logout)
+}
+
+// Ally proposes, accepts or breaks an Alliance with another Team
+func (t *Server) Ally(args ClientCommand, response *string) error {
+	return t.run(args, response, t.ally)
+}
+
+// Invite manages invite codes for private Teams, or uses one to switch Teams
+func (t *Server) Invite(args ClientCommand, response *string) error {
+	return t.run(args, response, t.invite)
+}
+
+// Merge proposes and accepts merges between Teams
+func (t *Server) Merge(args ClientCommand, response *string) error {
+	return t.run(args, response, t.merge)
+}
+
+// Admin grants the calling session admin privileges if given the admin password
+func (t *Server) Admin(args ClientCommand, response *string) error {
+	return t.runOpen(args, response, t.admin)
+}
+
+// Kick removes a Player from the Game, admin only
+func (t *Server) Kick(args ClientCommand, response *string) error {
+	return t.runAdmin(args, response, t.kick)
+}
+
+// Ban removes a Player from the Game and keeps them out, admin only
+func (t *Server) Ban(args ClientCommand, response *string) error {
+	return t.runAdmin(args, response, t.ban)
+}
+
+// Unban lifts a Ban, admin only
+func (t *Server) Unban(args ClientCommand, response *string) error {
+	return t.runAdmin(args, response, t.unban)
+}
+
+// Delay sets how far behind the live Game spectators see, admin only
+func (t *Server) Delay(args ClientCommand, response *string) error {
+	return t.runAdmin(args, response, t.delay)
+}
+
+// Silence stops a Player chatting for a while, admin only
+func (t *Server) Silence(args ClientCommand, response *string) error {
+	return t.runAdmin(args, response, t.silence)
+}
+
+// Announce broadcasts a message to everyone on the Server, admin only
+func (t *Server) Announce(args ClientCommand, response *string) error {
+	return t.runAdmin(args, response, t.announce)
+}
+
+// Bot adds and removes bot Players, admin only
+func (t *Server) Bot(args ClientCommand, response *string) error {
+	return t.runAdmin(args, response, t.bot)
+}
+
+// Stats shows a Player's rating and lifetime stats
+func (t *Server) Stats(args ClientCommand, response *string) error {
+	return t.runOpen(args, response, t.stats)
+}
+
+// Shutdown stops the Server, admin only
+func (t *Server) Shutdown(args ClientCommand, response *string) error {
+	return t.runAdmin(args, response, t.shutdown)
+}
+
+// echoTest is used to confirm we are connected and the Client can send commands,
 // the Server can receive them, and the Server can send a response that the Client
 // can receive
-func (t *Server) EchoTest(args ClientCommand, response *string) error {
+func (t *Server) echoTest(player *game.Player, args ClientCommand, response *string) error {
 
 	*response = fmt.Sprintf("Echo command successful\n%#v\n", args)
 
-	player := t.game.GetPlayerById(args.PlayerId)
-
 	timeStamp()
 	fmt.Printf("Echo command received\n")
-	fmt.Printf("\t-Player: %v (%v)\n", player.Username, args.PlayerId)
+	fmt.Printf("\t-Player: %v (%v)\n", player.Username, player.Id)
 	fmt.Printf("\t-Fields: %v\n", args.Fields)
 
 	return nil
 
 }
 
-func PrintMap(boardSize uint8, icon func(x, y int) string) string {
-	// Produce a string and put in response
-	output := "    "
-
-	// Top row
-	for x := 0; x <= int(boardSize - 1); x++ {
-		output += fmt.Sprintf("%-2v", base26.ConvertToBase26(x))
-	}
-	output += "\n"
-	for y:= 0; y < int(boardSize); y++ {
-		output += fmt.Sprintf("%3v ", strconv.Itoa(y))
-		for x:= 0; x < int(boardSize); x++ {
-			output += icon(x, y)
-		}
-		output += "\n"
-	}
-
-	return output
-}
+// showMap sends the calling Player's Team map, or for spectators the map of the Team they
+// choose as it was SpectatorDelay ago
+func (t *Server) showMap(player *game.Player, args ClientCommand, reply *MapReply) error {
 
+	// Get the Team Map based on the Player who called the command
+	if player.Spectator {
 
-func (t *Server) Map(args ClientCommand, response *string) error {
+		// Spectators pick which Team to watch, and see it as it was SpectatorDelay ago
+		if len(args.Fields) < 2 {
+			return errors.New("spectators must choose a team to watch: map <team#>")
+		}
 
-	// Get the Team Map based on the Player who called the command
-	player := t.game.GetPlayerById(args.PlayerId)
-	teamMap := t.game.GetMap(player.Team)
+		team, err := t.selectTeam(args.Fields[1])
+		if err != nil {
+			return err
+		}
 
-	// Parse full command to determine section of map to render
+		reply.Cells = t.game.GetMapAt(team, t.game.SpectatorCutoff())
+		reply.Team = team.Name
+	} else {
+		reply.Cells = t.game.GetMap(player.Team)
+		reply.Team = player.Team.Name
+	}
 
-	*response = PrintMap(t.game.BoardSize, func(x, y int) string {
-		return teamMap[x][y]
-	})
+	reply.Size = t.game.BoardSize
 
 	timeStamp()
 	fmt.Printf("Map Request\n")
-	fmt.Printf("\t-Player: %v (%v)\n", player.Username, args.PlayerId)
+	fmt.Printf("\t-Player: %v (%v)\n", player.Username, player.Id)
 
 
 	return nil
 }
 
 
-func (t *Server) Radar(args ClientCommand, response *string) error {
+// showRadar sends the shots the calling Player's Team has fired on another Team, or for
+// spectators the shots one Team has fired on another as they were SpectatorDelay ago
+func (t *Server) showRadar(player *game.Player, args ClientCommand, reply *MapReply) error {
 
 	if len(args.Fields) < 2 {
 		return errors.New("must target radar at a specific team: radar <team#>")
 	}
 
-	teamNum, err := strconv.Atoi(args.Fields[1])
+	targetTeam, err := t.selectTeam(args.Fields[1])
 	if err != nil {
-		return errors.New("team selection invalid")
-	}
-
-	if teamNum < 1 || teamNum > len(t.game.Teams) {
-		return errors.New("team selection out of range")
-
+		return err
 	}
 
-	targetTeam := t.game.Teams[teamNum-1]
-	if targetTeam == t.game.GetPlayerById(args.PlayerId).Team {
+	if targetTeam == player.Team {
 		return errors.New("you cannot target your own team")
 	}
 
 	// Get the Team Map based on the Player who called the command
-	player := t.game.GetPlayerById(args.PlayerId)
-	teamMap := t.game.GetRadar(player.Team, targetTeam)
+	if player.Spectator {
 
-	// Parse full command to determine section of map to render
+		// Spectators choose whose radar to look at as well as the target
+		if len(args.Fields) < 3 {
+			return errors.New("spectators must choose both teams: radar <team#> <target team#>")
+		}
 
-	*response = PrintMap(t.game.BoardSize, func(x, y int) string {
-		return teamMap[x][y]
-	})
+		spotter := targetTeam
+		targetTeam, err = t.selectTeam(args.Fields[2])
+		if err != nil {
+			return err
+		}
+
+		reply.Cells = t.game.GetRadarAt(spotter, targetTeam, t.game.SpectatorCutoff())
+		reply.Team = spotter.Name
+	} else {
+		reply.Cells = t.game.GetRadar(player.Team, targetTeam)
+		reply.Team = player.Team.Name
+	}
+
+	reply.Target = targetTeam.Name
+	reply.Size = t.game.BoardSize
 
 	timeStamp()
 	fmt.Printf("Radar Request\n")
-	fmt.Printf("\t-Player: %v (%v)\n", player.Username, args.PlayerId)
+	fmt.Printf("\t-Player: %v (%v)\n", player.Username, player.Id)
 
 
 	return nil
 }
 
-// Teams serves a list of all the Teams playing on this server, with a * in front
-// of the calling Player's Team
-func (t *Server) Teams(args ClientCommand, response *string) error {
-	output := ""
-
-	player := t.game.GetPlayerById(args.PlayerId)
+// listTeams serves a list of all the Teams playing on this server, marking the calling
+// Player's Team
+func (t *Server) listTeams(player *game.Player, args ClientCommand, reply *TeamsReply) error {
 
-	for id, team := range t.game.Teams {
-		var strId string = ""
-
-		if player.Team == team {
-			strId = fmt.Sprintf("*%v", id + 1)
-		} else {
-			strId = fmt.Sprintf("%v", id + 1)
-		}
-
-		output += fmt.Sprintf("%3v:\t%v\n", strId, team.Name)
+	for _, team := range t.game.Teams {
+		reply.Teams = append(reply.Teams, t.summarizeTeam(player, team))
 	}
 
-	*response = output
-
-
 	timeStamp()
 	fmt.Printf("Team List Request\n")
-	fmt.Printf("\t-Player: %v (%v)\n", player.Username, args.PlayerId)
+	fmt.Printf("\t-Player: %v (%v)\n", player.Username, player.Id)
 
 	return nil
 }
 
-// Players serves a list of Players on a given team# (team# based on Teams command)
-func (t *Server) Players(args ClientCommand, response *string) error {
-	output := ""
+// listPlayers serves a list of Players on a given team (by ID or name, see Teams command),
+// or on every Team, showing who is online, AFK or departed
+func (t *Server) listPlayers(player *game.Player, args ClientCommand, reply *PlayersReply) error {
 
-	playerTeam := t.game.GetPlayerById(args.PlayerId).Team
+	teams := t.game.Teams
 
 	// If a team number is specified
 	if len(args.Fields) > 1 {
-		teamNum, err := strconv.Atoi(args.Fields[1])
+		team, err := t.selectTeam(args.Fields[1])
 		if err != nil {
-			return errors.New("Team selection invalid")
+			return err
 		}
 
-		if teamNum < 1 || teamNum > len(t.game.Teams) {
-			return errors.New("Team selection out of range")
-
-		}
+		teams = []*game.Team{team}
+		reply.Selected = true
+	}
 
-		team := t.game.Teams[teamNum-1]
+	for _, team := range teams {
+		roster := TeamRoster{TeamSummary: t.summarizeTeam(player, team)}
 
-		output += fmt.Sprintf("\n%v [ %v player(s) ]\n", team.Name, team.NumPlayers)
-		output += fmt.Sprintf("%8v %-20v\n", "Points", "Username")
+		for _, member := range team.Players {
+			summary := t.summarizePlayer(member)
 
-		for _, player := range team.Players {
-			// If its their team, show the points
-			if team == playerTeam {
-				output += fmt.Sprintf("%8v %-20v\n", player.Points, player.Username)
-			} else {
-				output += fmt.Sprintf("%8v %-20v\n", "?", player.Username)}
-		}
-	} else {
-		for num, team := range t.game.Teams {
-			output += fmt.Sprintf("Team %v: %v\n", num + 1, team.Name)
-
-			for _, player := range team.Players {
-				// If its their team, show the points
-				if team == playerTeam {
-					output += fmt.Sprintf("%8v %-20v\n", player.Points, player.Username)
-				} else {
-					output += fmt.Sprintf("%8v %-20v\n", "?", player.Username)}
+			// Points are only shown to the Player's own Team. Spectators see everyone's,
+			// unless they are watching on a delay the live points would give away
+			if (team != player.Team && !player.Spectator) || t.delayed(player) {
+				summary.Points = 0
+				summary.PointsHidden = true
 			}
+
+			roster.Members = append(roster.Members, summary)
 		}
+
+		reply.Teams = append(reply.Teams, roster)
 	}
 
-	*response = output
+	if !reply.Selected {
+		for _, spectator := range t.game.Spectators {
+			reply.Spectators = append(reply.Spectators, t.summarizePlayer(spectator))
+		}
+	}
 
 	return nil
 }
 
-// Target fires a shot
-func (t *Server) Target(args ClientCommand, response *string) error {
+// summarizeTeam describes a Team for a list of Teams
+func (t *Server) summarizeTeam(player *game.Player, team *game.Team) TeamSummary {
+
+	summary := TeamSummary{
+		Id:      team.Id,
+		Name:    team.Name,
+		Yours:   team == player.Team,
+		Players: team.NumPlayers,
+		Active:  team.ActivePlayers(),
+		Ships:   len(team.Ships),
+	}
+
+	// A live Ship count would show sinks before the delayed maps do
+	if t.delayed(player) {
+		summary.Ships = 0
+		summary.ShipsHidden = true
+	}
+
+	return summary
+}
+
+// delayed returns true for spectators watching the Game SpectatorDelay behind
+func (t *Server) delayed(player *game.Player) bool {
+	return player.Spectator && t.game.SpectatorDelay > 0
+}
+
+// summarizePlayer describes a Player for a list of Players
+func (t *Server) summarizePlayer(player *game.Player) PlayerSummary {
+
+	summary := PlayerSummary{
+		Username: player.Username,
+		Points:   player.Points,
+		Status:   t.game.Presence(player).String(),
+	}
+
+	if player.Bot != nil {
+		summary.Bot = player.Bot.Difficulty.String()
+	}
+
+	return summary
+}
+
+// target fires a shot
+func (t *Server) target(player *game.Player, args ClientCommand, reply *ShotReply) error {
 
-	player := t.game.GetPlayerById(args.PlayerId)
 
 	// command structure: 	target [team#] [Target{}]
 	// 						target 2 G7
@@ -352,11 +833,10 @@ func (t *Server) Target(args ClientCommand, response *string) error {
 		return errors.New("not enough arguments to perform target command: target <team#> <target_coordinate>")
 	}
 
-	teamNum, err := strconv.Atoi(args.Fields[1])
-
-	// Target team number must be a valid team 1-#ofTeams
-	if teamNum > len(t.game.Teams) || teamNum < 1 {
-		return errors.New("not a valid target number. Run 'teams' to see a list of teams and their team#")
+	// Target team must be a valid team ID or name
+	team, err := t.selectTeam(args.Fields[1])
+	if err != nil {
+		return err
 	}
 
 	// You must have ships to target another team
@@ -364,11 +844,14 @@ func (t *Server) Target(args ClientCommand, response *string) error {
 		return errors.New("you must have ships deployed to fire shots")
 	}
 
-	team := t.game.Teams[teamNum - 1]
 	if team == player.Team {
 		return errors.New("you cannot target your own team")
 	}
 
+	if t.game.Allied(player.Team, team) {
+		return errors.New("you cannot target an allied team")
+	}
+
 
 
 	// Parse into Target{} (split letters from numbers)
@@ -380,38 +863,26 @@ func (t *Server) Target(args ClientCommand, response *string) error {
 
 	timeStamp()
 	fmt.Printf("Shots Fired!\n")
-	fmt.Printf("\t-Player: %v (%v)\n", player.Username, args.PlayerId)
+	fmt.Printf("\t-Player: %v (%v)\n", player.Username, player.Id)
 	fmt.Printf("\t-Target Team: %v\n", team.Name)
 	fmt.Printf("\t-Coordinate: %v ( %v )\n", target, target.ToCoordinate())
 
-	output := ""
-
 	shotResult := game.FireShot(player, team, target)
+	fmt.Printf("\t-Result: %v\n", shotResult)
 
-	if shotResult == game.HIT {
-		output += "Shot confirmed HIT!\n"
-		output += fmt.Sprintf("%v hit streak\n", player.HitStreak)
-		fmt.Printf("\t-Result: HIT\n");
-	} else if shotResult == game.REPEAT_HIT {
-		output += "Shot confirmed HIT but no further damage inflicted!\n"
-		fmt.Printf("\t-Result: REPEAT HIT\n");
-	} else if shotResult == game.MISS {
-		output += "Shot confirmed MISS!\n"
-		fmt.Printf("\t-Result: MISS\n");
-	} else if shotResult == game.SINK {
-		output += "Shot confirmed HIT... enemy ship SUNK!\n"
-		fmt.Printf("\t-Result: HIT and SINK\n");
-	}
-
-	*response = output
+	reply.Team = team.Name
+	reply.Target = fmt.Sprintf("%v%v", target.X, target.Y)
+	reply.Result = shotResult
+	reply.Streak = player.HitStreak
+	reply.Points = player.Points
 
 	return nil
 
 }
 
-func (t *Server) Deploy(args ClientCommand, response *string) error {
+// deploy places a new Ship for the calling Player's Team
+func (t *Server) deploy(player *game.Player, args ClientCommand, reply *DeployReply) error {
 
-	player := t.game.GetPlayerById(args.PlayerId)
 
 	var location game.Target
 	var size int
@@ -446,40 +917,122 @@ func (t *Server) Deploy(args ClientCommand, response *string) error {
 		return errors.New("ship orientation selection invalid: deploy <location> <size> <orientation( H|V )>")
 	}
 
-	// Make sure team has enough deployment points
-	if player.Team.DeploymentPoints >= size {
-		_, err = player.Team.NewShip(uint8(size), orientation, location.ToCoordinate())
-		if err != nil {
-			return err
-		}
-	} else {
-		return errors.New("not enough deployment points")
+	_, err = player.Team.Deploy(uint8(size), orientation, location.ToCoordinate())
+	if err != nil {
+		return err
 	}
 
-	player.Team.DeploymentPoints -= size
-
-	*response = fmt.Sprintf("Ship deployed - %v deployment points remaining",  player.Team.DeploymentPoints)
+	reply.Location = fmt.Sprintf("%v%v", location.X, location.Y)
+	reply.Size = uint8(size)
+	reply.Orientation = orientation
+	reply.DeploymentPoints = player.Team.DeploymentPoints
 
 	return nil
 
 }
 
 
-func (t *Server) Points (args ClientCommand, response *string) error {
-	*response = fmt.Sprintf("Your team has %v deployment points",
-		t.game.GetPlayerById(args.PlayerId).Team.DeploymentPoints)
+// switchTeam moves the calling Player to another Team, as long as the switch doesn't
+// break the Game's cooldown or imbalance rules
+func (t *Server) switchTeam(player *game.Player, args ClientCommand, response *string) error {
 
-	return nil
-}
 
+	if len(args.Fields) < 2 {
+		return errors.New("must choose a team to switch to: switch <team#>")
+	}
 
-//////// HELP COMMANDS ///////////
+	newTeam, err := t.selectTeam(args.Fields[1])
+	if err != nil {
+		return err
+	}
+
+	oldTeam := player.Team
+	oldPoints := player.Points
+
+	if err := t.game.ChangeTeam(player, newTeam); err != nil {
+		return err
+	}
+
+	// Points never go below 0, so the switch may have cost less than SWITCH_COST
+	*response = fmt.Sprintf("You have left %v and joined %v\n", oldTeam.Name, newTeam.Name)
+	*response += fmt.Sprintf("Switching teams cost you %v points, you now have %v", oldPoints - player.Points, player.Points)
+
+	timeStamp()
+	fmt.Printf("Team Switch\n")
+	fmt.Printf("\t-Player: %v (%v)\n", player.Username, player.Id)
+	fmt.Printf("\t-From %v to %v\n", oldTeam.Name, newTeam.Name)
+	fmt.Printf("\n\t[Teams]\n")
+	PrintTeamCounts(t.game)
+
+	return nil
+}
+
+
+// points sends the calling Player's Team's deployment points
+func (t *Server) points(player *game.Player, args ClientCommand, reply *PointsReply) error {
+	reply.DeploymentPoints = player.Team.DeploymentPoints
+
+	return nil
+}
+
+
+// stats shows the rating and lifetime stats of the calling Player, or of another
+// registered Player: stats [username]
+func (t *Server) stats(player *game.Player, args ClientCommand, response *string) error {
+
+	if t.game.Registry == nil {
+		return errors.New("this server does not keep a player registry")
+	}
 
+	username := player.Username
+	if len(args.Fields) > 1 {
+		username = args.Fields[1]
+	}
+
+	account := t.game.Registry.Get(username)
+	if account == nil {
+		return errors.New("there is no registered player with that username")
+	}
 
-func (t *Server) ChatHelp (args ClientCommand, response *string) error {
+	output := fmt.Sprintf("%v\n", account.Username)
+	output += fmt.Sprintf("\t%-16v %v\n", "Rating:", account.Rating)
+	output += fmt.Sprintf("\t%-16v %v\n", "Games Played:", account.Stats.GamesPlayed)
+	output += fmt.Sprintf("\t%-16v %v\n", "Shots Fired:", account.Stats.ShotsFired)
+	output += fmt.Sprintf("\t%-16v %v\n", "Hits:", account.Stats.Hits)
+	output += fmt.Sprintf("\t%-16v %v\n", "Ships Sunk:", account.Stats.Sinks)
+	output += fmt.Sprintf("\t%-16v %v\n", "Points Earned:", account.Stats.PointsEarned)
+	output += fmt.Sprintf("\t%-16v %v\n", "Member Since:", account.Created.Format("January 2, 2006"))
+
+	*response = output
+
+	return nil
+}
+
+// logout revokes the session the command was sent with
+func (t *Server) logout(player *game.Player, args ClientCommand, response *string) error {
+	t.sessions.Revoke(args.Token)
+	player.Depart()
+
+	*response = "Logged out"
+
+	timeStamp()
+	fmt.Printf("Player logged out\n")
+	fmt.Printf("\t-Player: %v (%v)\n", player.Username, player.Id)
+
+	return nil
+}
+
+
+//////// HELP COMMANDS ///////////
+
+
+func (t *Server) chatHelp(player *game.Player, args ClientCommand, response *string) error {
 	output := "\t Type $ followed by a space and your message to CHAT ALL\n"
 	output += "\t Type # followed by a space and your message to TEAM CHAT\n"
-	output += "\t Type @ followed by a space, username, space and your message to PRIVATE CHAT\n"
+	output += "\t Type @ followed by a username, space and your message to PRIVATE CHAT\n"
+	output += "\t Type history [all|team|@username] [n] to see the last n messages\n"
+	output += "\t Type mute <username> to hide a player's messages\n"
+	output += "\t Type ignore <username> to hide a player's messages and block their private messages\n"
 
 	*response = output
 
@@ -490,10 +1043,9 @@ func (t *Server) ChatHelp (args ClientCommand, response *string) error {
 
 //////// LEADER COMMANDS //////////
 
-// Rename a team
-func (t *Server) Rename(args ClientCommand, response *string) error {
+// rename renames a team
+func (t *Server) rename(player *game.Player, args ClientCommand, response *string) error {
 
-	player := t.game.GetPlayerById(args.PlayerId)
 	if player != player.Team.TopPlayer() {
 		return errors.New("you must be team leader to do this (player on your team with them most points)")
 	}
@@ -506,25 +1058,26 @@ func (t *Server) Rename(args ClientCommand, response *string) error {
 	oldName := player.Team.Name
 	newName := args.Fields[1]
 
-	if t.game.UniqueTeamName(newName) {
-		player.Team.Name = newName
-	} else {
-		return errors.New("team name already taken")
+	if err := t.game.CheckTeamName(newName); err != nil {
+		return err
 	}
 
+	player.Team.Name = newName
+
+	t.game.Announce("%v is now known as %v", oldName, newName)
+
 	*response = fmt.Sprintf("Team %v renamed to %v", oldName, newName)
 
 	timeStamp()
 	fmt.Printf("Team Renamed\n")
-	fmt.Printf("\t-Player: %v (%v)\n", player.Username, args.PlayerId)
+	fmt.Printf("\t-Player: %v (%v)\n", player.Username, player.Id)
 	fmt.Printf("\t-Team %v renamed to %v\n", oldName, newName)
 
 	return nil
 }
 
-// Mutiny will start a new team and steal half the deployment points, but your score is reset to 10
-func (t *Server) Mutiny(args ClientCommand, response *string) error {
-	player := t.game.GetPlayerById(args.PlayerId)
+// mutiny will start a new team and steal half the deployment points, but your score is reset to 10
+func (t *Server) mutiny(player *game.Player, args ClientCommand, response *string) error {
 	//if player == player.Team.TopPlayer() {
 	//	return errors.New("you cannot be team leader to do this (player on your team with them most points)")
 	//}
@@ -537,6 +1090,10 @@ func (t *Server) Mutiny(args ClientCommand, response *string) error {
 		return errors.New("not enough arguments to perform target command: mutiny <new_name>")
 	}
 
+	if err := t.game.CheckTeamName(args.Fields[1]); err != nil {
+		return err
+	}
+
 	oldTeam := player.Team
 	newTeam := t.game.NewTeam()
 
@@ -548,6 +1105,8 @@ func (t *Server) Mutiny(args ClientCommand, response *string) error {
 	game.SwitchTeam(player, newTeam)
 	player.Points = 10
 
+	t.game.Announce("Mutiny! %v has deserted %v to form a new team: %v", player.Username, oldTeam.Name, newTeam.Name)
+
 	output := fmt.Sprintf("Treachery! You have stolen %v deployment points to start your own team: %v\n",
 		newTeam.DeploymentPoints, newTeam.Name)
 
@@ -558,7 +1117,7 @@ func (t *Server) Mutiny(args ClientCommand, response *string) error {
 
 	timeStamp()
 	fmt.Printf("Mutiny!\n")
-	fmt.Printf("\t-Player: %v (%v)\n", player.Username, args.PlayerId)
+	fmt.Printf("\t-Player: %v (%v)\n", player.Username, player.Id)
 	fmt.Printf("\n\t[Teams]\n")
 	PrintTeamCounts(t.game)
 
@@ -566,17 +1125,511 @@ func (t *Server) Mutiny(args ClientCommand, response *string) error {
 
 }
 
+// ally handles diplomacy between Teams: ally [propose|accept|break] <team#>. With no
+// arguments it lists the Team's alliances and any pending proposals
+func (t *Server) ally(player *game.Player, args ClientCommand, response *string) error {
+
+	if len(args.Fields) < 2 {
+		*response = t.listAlliances(player.Team)
+		return nil
+	}
+
+	if player != player.Team.TopPlayer() {
+		return errors.New("you must be team leader to do this (player on your team with them most points)")
+	}
+
+	if len(args.Fields) < 3 {
+		return errors.New("not enough arguments to perform ally command: ally <propose|accept|break> <team#>")
+	}
+
+	otherTeam, err := t.selectTeam(args.Fields[2])
+	if err != nil {
+		return err
+	}
+
+	switch args.Fields[1] {
+	case "propose":
+		alliance, err := t.game.ProposeAlliance(player.Team, otherTeam)
+		if err != nil {
+			return err
+		}
+
+		if alliance != nil {
+			*response = fmt.Sprintf("%v had already proposed an alliance, your teams are now allied", otherTeam.Name)
+		} else {
+			*response = fmt.Sprintf("Alliance proposed to %v", otherTeam.Name)
+		}
+	case "accept":
+		if _, err := t.game.AcceptAlliance(player.Team, otherTeam); err != nil {
+			return err
+		}
+		*response = fmt.Sprintf("Your team is now allied with %v", otherTeam.Name)
+	case "break":
+		if err := t.game.BreakAlliance(player.Team, otherTeam); err != nil {
+			return err
+		}
+		*response = fmt.Sprintf("Your alliance with %v is over", otherTeam.Name)
+	default:
+		return errors.New("unknown ally command: ally <propose|accept|break> <team#>")
+	}
+
+	timeStamp()
+	fmt.Printf("Diplomacy\n")
+	fmt.Printf("\t-Player: %v (%v)\n", player.Username, player.Id)
+	fmt.Printf("\t-%v %v %v\n", player.Team.Name, args.Fields[1], otherTeam.Name)
+
+	return nil
+}
+
+// invite handles private Teams: invite [private|public|new] for Team leaders, and
+// invite use <code> for any Player wanting to switch to the Team that made the code
+func (t *Server) invite(player *game.Player, args ClientCommand, response *string) error {
+
+	if len(args.Fields) < 2 {
+		return errors.New("not enough arguments to perform invite command: invite <private|public|new|use <code>>")
+	}
+
+	// Using a code is open to everyone, everything else is for leaders only
+	if args.Fields[1] == "use" {
+		if len(args.Fields) < 3 {
+			return errors.New("must give the invite code: invite use <code>")
+		}
+
+		oldTeam := player.Team
+		newTeam, err := t.game.UseInviteCode(player, args.Fields[2])
+		if err != nil {
+			return err
+		}
+
+		*response = fmt.Sprintf("Invite accepted, you have left %v and joined %v", oldTeam.Name, newTeam.Name)
+
+		timeStamp()
+		fmt.Printf("Team Switch By Invite\n")
+		fmt.Printf("\t-Player: %v (%v)\n", player.Username, player.Id)
+		fmt.Printf("\t-From %v to %v\n", oldTeam.Name, newTeam.Name)
+		fmt.Printf("\n\t[Teams]\n")
+		PrintTeamCounts(t.game)
+
+		return nil
+	}
+
+	if player != player.Team.TopPlayer() {
+		return errors.New("you must be team leader to do this (player on your team with them most points)")
+	}
+
+	switch args.Fields[1] {
+	case "private":
+		player.Team.InviteOnly = true
+		*response = "Your team is now invite only. Run 'invite new' to make invite codes"
+	case "public":
+		player.Team.InviteOnly = false
+		*response = "Your team is now open to everyone"
+	case "new":
+		code, err := player.Team.NewInviteCode()
+		if err != nil {
+			return err
+		}
+		*response = fmt.Sprintf("Invite code: %v (single use, expires in %v)", code, game.INVITE_CODE_LIFETIME)
+	default:
+		return errors.New("unknown invite command: invite <private|public|new|use <code>>")
+	}
+
+	timeStamp()
+	fmt.Printf("Team Invites\n")
+	fmt.Printf("\t-Player: %v (%v)\n", player.Username, player.Id)
+	fmt.Printf("\t-%v: invite %v\n", player.Team.Name, args.Fields[1])
+
+	return nil
+}
+
+// merge handles merging Teams: merge propose <team#> <new_name>, merge accept <team#>.
+// With no arguments it lists the merges proposed to and by the Player's Team
+func (t *Server) merge(player *game.Player, args ClientCommand, response *string) error {
+
+	usage := "merge propose <team#> <new_name> or merge accept <team#>"
+
+	if len(args.Fields) < 2 {
+		output := "Pending merges:\n"
+		for _, proposal := range t.game.MergeProposalsFor(player.Team) {
+			if proposal.From == player.Team {
+				output += fmt.Sprintf("\twith %v as %v\n", proposal.To.Name, proposal.Name)
+			} else {
+				output += fmt.Sprintf("\tfrom %v as %v\n", proposal.From.Name, proposal.Name)
+			}
+		}
+		*response = output
+		return nil
+	}
+
+	if player != player.Team.TopPlayer() {
+		return errors.New("you must be team leader to do this (player on your team with them most points)")
+	}
+
+	if len(args.Fields) < 3 {
+		return errors.New("not enough arguments to perform merge command: " + usage)
+	}
+
+	otherTeam, err := t.selectTeam(args.Fields[2])
+	if err != nil {
+		return err
+	}
+
+	var merged *game.Team
+
+	switch args.Fields[1] {
+	case "propose":
+		if len(args.Fields) < 4 {
+			return errors.New("not enough arguments to perform merge command: " + usage)
+		}
+
+		merged, err = t.game.ProposeMerge(player.Team, otherTeam, args.Fields[3])
+		if err != nil {
+			return err
+		}
+
+		if merged == nil {
+			*response = fmt.Sprintf("Merge proposed to %v, their leader must accept", otherTeam.Name)
+		}
+	case "accept":
+		merged, err = t.game.AcceptMerge(player.Team, otherTeam)
+		if err != nil {
+			return err
+		}
+	default:
+		return errors.New("unknown merge command: " + usage)
+	}
+
+	if merged != nil {
+		*response = fmt.Sprintf("Your teams have merged to form %v", merged.Name)
+	}
+
+	timeStamp()
+	fmt.Printf("Team Merge\n")
+	fmt.Printf("\t-Player: %v (%v)\n", player.Username, player.Id)
+	fmt.Printf("\t-%v %v %v\n", player.Team.Name, args.Fields[1], otherTeam.Name)
+	if merged != nil {
+		fmt.Printf("\n\t[Teams]\n")
+		PrintTeamCounts(t.game)
+	}
+
+	return nil
+}
+
+// listAlliances describes a Team's alliances and the proposals made to and by it
+func (t *Server) listAlliances(team *game.Team) string {
+	output := "Allies:\n"
+
+	for _, ally := range t.game.Allies(team) {
+		output += fmt.Sprintf("\t%v\n", ally.Name)
+	}
+
+	output += "Pending proposals:\n"
+	for _, proposal := range t.game.AllianceProposals {
+		if proposal.From == team {
+			output += fmt.Sprintf("\tto %v\n", proposal.To.Name)
+		} else if proposal.To == team {
+			output += fmt.Sprintf("\tfrom %v\n", proposal.From.Name)
+		}
+	}
+
+	return output
+}
+
+// selectTeam converts a team ID or name from the Teams list into the Team it refers to
+func (t *Server) selectTeam(field string) (*game.Team, error) {
+	team := t.game.GetTeam(field)
+	if team == nil {
+		return nil, errors.New("no team with that ID or name. Run 'teams' to see a list of teams and their IDs")
+	}
+
+	return team, nil
+}
+
 //////// ADMIN COMMANDS //////////
 
-func (t *Server) Shutdown(args ClientCommand, response *string) error {
+// admin promotes the session the command was sent with: admin <password>
+func (t *Server) admin(player *game.Player, args ClientCommand, response *string) error {
+
+	if len(args.Fields) < 2 {
+		return errors.New("must follow admin command with admin password: admin <password>")
+	}
+
+	// An empty admin password means nobody can be admin
+	password := args.Fields[1]
+	if t.game.AdminPassword == "" ||
+		subtle.ConstantTimeCompare([]byte(password), []byte(t.game.AdminPassword)) != 1 {
+
+		timeStamp()
+		fmt.Printf("Failed admin login\n")
+		fmt.Printf("\t-Player: %v (%v)\n", player.Username, player.Id)
+
+		return errors.New("incorrect admin password")
+	}
+
+	t.sessions.Promote(args.Token)
+
+	*response = "Admin privileges granted for this session"
+
+	timeStamp()
+	fmt.Printf("Admin login\n")
+	fmt.Printf("\t-Player: %v (%v)\n", player.Username, player.Id)
+
+	return nil
+}
+
+// kick removes a Player from their Team and ends their sessions: kick <username>
+func (t *Server) kick(admin *game.Player, args ClientCommand, response *string) error {
+
+	if len(args.Fields) < 2 {
+		return errors.New("not enough arguments to perform kick command: kick <username>")
+	}
+
+	target := t.game.GetPlayerByUsername(args.Fields[1])
+	if target == nil {
+		target = t.game.GetSpectator(args.Fields[1])
+	}
+	if target == nil {
+		return errors.New("no player with that username")
+	}
+
+	t.removePlayer(target)
+	t.game.Announce("%v has been kicked from the server", target.Username)
+
+	*response = fmt.Sprintf("Kicked %v", target.Username)
+
+	timeStamp()
+	fmt.Printf("Player Kicked\n")
+	fmt.Printf("\t-Admin: %v (%v)\n", admin.Username, admin.Id)
+	fmt.Printf("\t-Kicked: %v (%v)\n", target.Username, target.Id)
+	fmt.Printf("\n\t[Teams]\n")
+	PrintTeamCounts(t.game)
+
+	return nil
+}
+
+// ban removes a Player and keeps them out by username and address, either for good
+// or for a while: ban <username> [duration]
+func (t *Server) ban(admin *game.Player, args ClientCommand, response *string) error {
+
+	if len(args.Fields) < 2 {
+		return errors.New("not enough arguments to perform ban command: ban <username> [duration]")
+	}
+
+	ban := &game.Ban{Username: args.Fields[1]}
+
+	if len(args.Fields) > 2 {
+		duration, err := time.ParseDuration(args.Fields[2])
+		if err != nil || duration <= 0 {
+			return errors.New("ban duration invalid, use a duration such as 30m or 12h: ban <username> [duration]")
+		}
+		ban.Expires = time.Now().Add(duration)
+	}
+
+	// Players can be banned whether or not they're in the Game right now
+	target := t.game.GetPlayerByUsername(ban.Username)
+	if target == nil {
+		target = t.game.GetSpectator(ban.Username)
+	}
+	if target != nil {
+		ban.Address = target.Address
+		t.removePlayer(target)
+	}
+
+	err := t.game.Bans.Add(ban)
+	if err != nil {
+		*response = "Ban is in place but could not be saved: " + err.Error()
+	} else if ban.Expires.IsZero() {
+		*response = fmt.Sprintf("Banned %v", ban.Username)
+	} else {
+		*response = fmt.Sprintf("Banned %v until %v", ban.Username, ban.Expires.Format(time.RFC1123))
+	}
+
+	t.game.Announce("%v has been banned from the server", ban.Username)
+
+	timeStamp()
+	fmt.Printf("Player Banned\n")
+	fmt.Printf("\t-Admin: %v (%v)\n", admin.Username, admin.Id)
+	fmt.Printf("\t-Banned: %v (%v)\n", ban.Username, ban.Address)
+	if err != nil {
+		fmt.Printf("\t-Error saving ban list: %v\n", err)
+	}
+
+	return nil
+}
+
+// unban lifts every Ban on a username: unban <username>
+func (t *Server) unban(admin *game.Player, args ClientCommand, response *string) error {
+
 	if len(args.Fields) < 2 {
-		return errors.New("Must follow admin command with admin password")
+		return errors.New("not enough arguments to perform unban command: unban <username>")
 	}
 
-	if args.Fields[1] == t.game.AdminPassword {
-		*response = "Shutting down server"
+	removed, err := t.game.Bans.Remove(args.Fields[1])
+	if err != nil {
+		return err
+	}
+
+	if !removed {
+		return errors.New("that username is not banned")
+	}
+
+	*response = fmt.Sprintf("Lifted ban on %v", args.Fields[1])
+
+	timeStamp()
+	fmt.Printf("Player Unbanned\n")
+	fmt.Printf("\t-Admin: %v (%v)\n", admin.Username, admin.Id)
+	fmt.Printf("\t-Unbanned: %v\n", args.Fields[1])
+
+	return nil
+}
+
+// delay sets how far behind the live Game spectators see: delay <duration>
+func (t *Server) delay(admin *game.Player, args ClientCommand, response *string) error {
+
+	if len(args.Fields) < 2 {
+		*response = fmt.Sprintf("Spectators are %v behind the game", t.game.SpectatorDelay)
+		return nil
+	}
+
+	delay, err := time.ParseDuration(args.Fields[1])
+	if err != nil || delay < 0 {
+		return errors.New("delay invalid, use a duration such as 30s or 2m: delay <duration>")
+	}
+
+	t.game.SpectatorDelay = delay
+
+	*response = fmt.Sprintf("Spectators will now see the game %v behind", delay)
+
+	timeStamp()
+	fmt.Printf("Spectator Delay Changed\n")
+	fmt.Printf("\t-Admin: %v (%v)\n", admin.Username, admin.Id)
+	fmt.Printf("\t-Delay: %v\n", delay)
+
+	return nil
+}
+
+// announce broadcasts a message to every Player and spectator: announce <message>
+func (t *Server) announce(admin *game.Player, args ClientCommand, response *string) error {
+
+	if len(args.Fields) < 2 {
+		return errors.New("not enough arguments to perform announce command: announce <message>")
 	}
 
+	message := strings.Join(args.Fields[1:], " ")
+	t.game.Announce("[ADMIN] %v", message)
+
+	*response = "Announcement sent"
+
+	timeStamp()
+	fmt.Printf("Admin Announcement\n")
+	fmt.Printf("\t-Admin: %v (%v)\n", admin.Username, admin.Id)
+	fmt.Printf("\t-Message: %v\n", message)
+
+	return nil
+}
+
+// bot manages bot Players: bot add [easy|medium|hard] [team#], bot remove <username>
+// or bot list
+func (t *Server) bot(admin *game.Player, args ClientCommand, response *string) error {
+
+	usage := "bot add [easy|medium|hard] [team#], bot remove <username> or bot list"
+
+	if len(args.Fields) < 2 || args.Fields[1] == "list" {
+		bots := t.game.Bots()
+		if len(bots) == 0 {
+			*response = "There are no bots in the game"
+			return nil
+		}
+
+		output := fmt.Sprintf("%-20v %-10v %v\n", "Username", "Difficulty", "Team")
+		for _, bot := range bots {
+			output += fmt.Sprintf("%-20v %-10v %v\n", bot.Username, bot.Bot.Difficulty, bot.Team.Name)
+		}
+		*response = output
+		return nil
+	}
+
+	switch args.Fields[1] {
+	case "add":
+		difficulty := game.MEDIUM
+		var team *game.Team
+		var err error
+
+		if len(args.Fields) > 2 {
+			difficulty, err = game.ParseDifficulty(args.Fields[2])
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(args.Fields) > 3 {
+			team, err = t.selectTeam(args.Fields[3])
+			if err != nil {
+				return err
+			}
+		}
+
+		bot, err := t.game.AddBot(difficulty, team)
+		if err != nil {
+			return err
+		}
+
+		*response = fmt.Sprintf("Added %v bot %v to %v", difficulty, bot.Username, bot.Team.Name)
+
+		timeStamp()
+		fmt.Printf("Bot Added\n")
+		fmt.Printf("\t-Admin: %v (%v)\n", admin.Username, admin.Id)
+		fmt.Printf("\t-Bot: %v (%v)\n", bot.Username, difficulty)
+		fmt.Printf("\t-Team: %v\n", bot.Team.Name)
+
+	case "remove":
+		if len(args.Fields) < 3 {
+			return errors.New("not enough arguments to perform bot command: " + usage)
+		}
+
+		bot := t.game.GetPlayerByUsername(args.Fields[2])
+		if bot == nil || bot.Bot == nil {
+			return errors.New("there is no bot with that username")
+		}
+
+		t.game.RemovePlayer(bot)
+
+		*response = fmt.Sprintf("Removed %v from %v", bot.Username, bot.Team.Name)
+
+		timeStamp()
+		fmt.Printf("Bot Removed\n")
+		fmt.Printf("\t-Admin: %v (%v)\n", admin.Username, admin.Id)
+		fmt.Printf("\t-Bot: %v\n", bot.Username)
+
+	default:
+		return errors.New("bot command invalid: " + usage)
+	}
+
+	return nil
+}
+
+// removePlayer takes a Player or spectator out of the Game and ends all of their sessions
+func (t *Server) removePlayer(player *game.Player) {
+	if player.Spectator {
+		t.game.RemoveSpectator(player)
+	} else {
+		t.game.RemovePlayer(player)
+	}
+	t.sessions.RevokePlayer(player)
+}
+
+// shutdown saves what needs saving and stops the Server
+func (t *Server) shutdown(player *game.Player, args ClientCommand, response *string) error {
+
+	timeStamp()
+	fmt.Printf("Shutdown\n")
+	fmt.Printf("\t-Admin: %v (%v)\n", player.Username, player.Id)
+
+	*response = "Shutting down server"
+
+	// Don't lose anything that happened since the last save
+	t.game.Registry.Save()
+
 	os.Exit(0)
 	return nil
 }
@@ -0,0 +1,1157 @@
+package net
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	game "github.com/jason-meredith/warships/game"
+)
+
+// newTestServer creates a Server with two empty Teams without opening any listeners
+func newTestServer() *Server {
+	newGame := game.Game{}
+	newGame.Live = true
+	newGame.MaxPlayers = 32
+	newGame.ShipLimit = 16
+	newGame.BoardSize = 16
+	newGame.Teams = []*game.Team{}
+	newGame.AdminPassword = "adminpass"
+	newGame.Bans = &game.BanList{}
+
+	server := new(Server)
+	server.game = &newGame
+	server.sessions = NewSessionStore(time.Minute)
+	server.chatRoom = NewChatRoom()
+	server.notifier = NewNotifier()
+
+	server.game.NewTeam()
+	server.game.NewTeam()
+
+	return server
+}
+
+// joinTestPlayer joins a Player to a test Server and returns their session token
+func joinTestPlayer(t *testing.T, server *Server, username string) string {
+	var details JoinDetails
+
+	err := server.JoinGame(LoginCredentials{Username: username, Password: username, ProtocolVersion: PROTOCOL_VERSION}, &details)
+	if err != nil {
+		t.Fatal("Error joining test player: ", err)
+	}
+
+	return details.Token
+}
+
+func TestServer_Authentication(t *testing.T) {
+
+	server := newTestServer()
+	token := joinTestPlayer(t, server, "j")
+
+	var response string
+	var points PointsReply
+
+	err := server.Points(ClientCommand{Token: token, Fields: []string{"points"}}, &points)
+	if err != nil {
+		t.Error("Command with a valid token should succeed: ", err)
+	}
+
+	// Unknown tokens must be turned away before the handler runs
+	var board MapReply
+	err = server.Map(ClientCommand{Token: "not-a-token", Fields: []string{"map"}}, &board)
+	if err != ErrUnauthorized {
+		t.Error("Command with an unknown token should return ErrUnauthorized")
+	}
+
+	err = server.Logout(ClientCommand{Token: token, Fields: []string{"logout"}}, &response)
+	if err != nil {
+		t.Error("Logout should succeed: ", err)
+	}
+
+	err = server.Points(ClientCommand{Token: token, Fields: []string{"points"}}, &points)
+	if err != ErrUnauthorized {
+		t.Error("Command with a revoked token should return ErrUnauthorized")
+	}
+}
+
+func TestSessionStore_Expiry(t *testing.T) {
+
+	store := NewSessionStore(50 * time.Millisecond)
+	player := &game.Player{Username: "j"}
+
+	session, _ := store.Issue(player)
+
+	// Activity should keep pushing the expiry back
+	for i := 0; i < 3; i++ {
+		time.Sleep(30 * time.Millisecond)
+		if _, err := store.Validate(session.Token); err != nil {
+			t.Error("Session should be renewed on activity")
+		}
+	}
+
+	time.Sleep(80 * time.Millisecond)
+	if _, err := store.Validate(session.Token); err != ErrUnauthorized {
+		t.Error("Idle session should expire")
+	}
+
+	store.Issue(player)
+	store.Issue(player)
+	store.RevokePlayer(player)
+	if len(store.sessions) != 0 {
+		t.Error("RevokePlayer should end every session for that Player")
+	}
+}
+
+func TestServer_Ally(t *testing.T) {
+
+	server := newTestServer()
+	tokenA := joinTestPlayer(t, server, "a")
+	tokenB := joinTestPlayer(t, server, "b")
+
+	var response string
+
+	err := server.Ally(ClientCommand{Token: tokenA, Fields: []string{"ally", "propose", "2"}}, &response)
+	if err != nil {
+		t.Error("Leader should be able to propose an alliance: ", err)
+	}
+
+	err = server.Ally(ClientCommand{Token: tokenB, Fields: []string{"ally", "accept", "1"}}, &response)
+	if err != nil {
+		t.Error("Leader should be able to accept an alliance: ", err)
+	}
+
+	// Player A should hear about the alliance with their next command
+	var points PointsReply
+	server.Points(ClientCommand{Token: tokenA, Fields: []string{"points"}}, &points)
+	if !strings.Contains(points.Announcements, "formed an alliance") {
+		t.Error("Alliance should be announced to every player")
+	}
+
+	server.game.Teams[1].NewShip(2, game.VERTICAL, game.Coordinate{X: 0, Y: 0})
+	var shot ShotReply
+	err = server.Target(ClientCommand{Token: tokenB, Fields: []string{"target", "1", "A0"}}, &shot)
+	if err == nil || err.Error() != "you cannot target an allied team" {
+		t.Error("Targeting an allied team should return error")
+	}
+}
+
+func TestServer_KickAndBan(t *testing.T) {
+
+	server := newTestServer()
+
+	// Serve RPCs the same way StartGameServer does so the remote address gets recorded
+	listener := httptest.NewServer(rpcHandler{server})
+	defer listener.Close()
+
+	connect := func(username string) (string, error) {
+		client, err := rpc.DialHTTPPath("tcp", listener.Listener.Addr().String(), "/")
+		if err != nil {
+			t.Fatal("Error connecting to test server: ", err)
+		}
+
+		var details JoinDetails
+		err = client.Call("Server.JoinGame", LoginCredentials{Username: username, Password: username, ProtocolVersion: PROTOCOL_VERSION}, &details)
+		return details.Token, err
+	}
+
+	adminToken, _ := connect("admin")
+	playerToken, _ := connect("j")
+
+	var response string
+
+	err := server.Kick(ClientCommand{Token: adminToken, Fields: []string{"kick", "j"}}, &response)
+	if err != ErrForbidden {
+		t.Error("Kick without admin privileges should return ErrForbidden")
+	}
+
+	// Knowing the admin password isn't enough to shut down without logging in as admin
+	err = server.Shutdown(ClientCommand{Token: playerToken, Fields: []string{"shutdown", "adminpass"}}, &response)
+	if err != ErrForbidden {
+		t.Error("Shutdown without admin privileges should return ErrForbidden")
+	}
+
+	err = server.Admin(ClientCommand{Token: adminToken, Fields: []string{"admin", "wrong"}}, &response)
+	if err == nil {
+		t.Error("Admin login with the wrong password should return error")
+	}
+
+	server.Admin(ClientCommand{Token: adminToken, Fields: []string{"admin", "adminpass"}}, &response)
+
+	kicked := server.game.GetPlayerByUsername("j")
+	team := kicked.Team
+	err = server.Kick(ClientCommand{Token: adminToken, Fields: []string{"kick", "j"}}, &response)
+	if err != nil {
+		t.Error("Admin should be able to kick: ", err)
+	}
+
+	if team.NumPlayers != 0 || len(team.Players) != 0 || server.game.GetPlayerByUsername("j") != nil {
+		t.Error("Kicked player should be removed from their team")
+	}
+
+	if server.Points(ClientCommand{Token: playerToken, Fields: []string{"points"}}, &PointsReply{}) != ErrUnauthorized {
+		t.Error("Kicked player's session should be revoked")
+	}
+
+	// Kicked players can come back, banned ones can't
+	if _, err := connect("j"); err != nil {
+		t.Error("Kicked player should be able to rejoin: ", err)
+	}
+
+	err = server.Ban(ClientCommand{Token: adminToken, Fields: []string{"ban", "j", "1h"}}, &response)
+	if err != nil {
+		t.Error("Admin should be able to ban: ", err)
+	}
+
+	if _, err := connect("j"); err == nil {
+		t.Error("Banned player should not be able to rejoin")
+	}
+
+	// The ban covers the address j connected from, so a new username doesn't help
+	if _, err := connect("k"); err == nil {
+		t.Error("Banned address should not be able to join under a new username")
+	}
+}
+
+func TestServer_Spectators(t *testing.T) {
+
+	server := newTestServer()
+	playerToken := joinTestPlayer(t, server, "j")
+
+	var details JoinDetails
+	err := server.JoinGame(LoginCredentials{Username: "s", Password: "s", Spectator: true, ProtocolVersion: PROTOCOL_VERSION}, &details)
+	if err != nil {
+		t.Error("Spectator should be able to join: ", err)
+	}
+
+	if server.game.NumPlayers() != 1 || len(server.game.Spectators) != 1 {
+		t.Error("Spectator should not be added to a team")
+	}
+
+	spectatorToken := details.Token
+	var response string
+
+	// Spectators can watch any team...
+	watch := map[string]func(ClientCommand) error{
+		"map 1":     func(c ClientCommand) error { return server.Map(c, &MapReply{}) },
+		"radar 1 2": func(c ClientCommand) error { return server.Radar(c, &MapReply{}) },
+		"teams":     func(c ClientCommand) error { return server.Teams(c, &TeamsReply{}) },
+		"players":   func(c ClientCommand) error { return server.Players(c, &PlayersReply{}) },
+	}
+
+	for command, rpcCall := range watch {
+		err := rpcCall(ClientCommand{Token: spectatorToken, Fields: strings.Fields(command)})
+		if err != nil {
+			t.Errorf("Spectator should be able to run %v: %v", command, err)
+		}
+	}
+
+	// ...but not take part
+	server.game.Teams[0].NewShip(2, game.VERTICAL, game.Coordinate{X: 0, Y: 0})
+	if server.Target(ClientCommand{Token: spectatorToken, Fields: []string{"target", "2", "A0"}}, &ShotReply{}) != ErrSpectator ||
+		server.Deploy(ClientCommand{Token: spectatorToken, Fields: []string{"deploy", "A0", "2", "H"}}, &DeployReply{}) != ErrSpectator ||
+		server.Mutiny(ClientCommand{Token: spectatorToken, Fields: []string{"mutiny", "rebels"}}, &response) != ErrSpectator {
+		t.Error("Spectators should not be able to run action commands")
+	}
+
+	t.Run("Delay", func(t *testing.T) {
+		server.game.SpectatorDelay = time.Hour
+
+		// j's Team is team 1, fire on team 2 which has no ships
+		server.Target(ClientCommand{Token: playerToken, Fields: []string{"target", "2", "B1"}}, &ShotReply{})
+
+		live := server.game.GetRadar(server.game.Teams[0], server.game.Teams[1])
+		delayed := server.game.GetRadarAt(server.game.Teams[0], server.game.Teams[1], server.game.SpectatorCutoff())
+		if live[1][1] != game.CELL_MISS || delayed[1][1] != game.CELL_EMPTY {
+			t.Error("Spectators should not see shots newer than the spectator delay")
+		}
+
+		server.game.SpectatorDelay = 0
+		delayed = server.game.GetRadarAt(server.game.Teams[0], server.game.Teams[1], server.game.SpectatorCutoff())
+		if delayed[1][1] != game.CELL_MISS {
+			t.Error("Spectators should see shots older than the spectator delay")
+		}
+
+		// Live points and Ship counts would give away what the delayed maps don't show yet
+		server.game.SpectatorDelay = time.Hour
+		var teams TeamsReply
+		server.Teams(ClientCommand{Token: spectatorToken, Fields: []string{"teams"}}, &teams)
+		if teams.Teams[0].Ships != 0 || !teams.Teams[0].ShipsHidden {
+			t.Errorf("Ship counts should be hidden from delayed spectators, got %+v", teams.Teams[0])
+		}
+
+		var players PlayersReply
+		server.Players(ClientCommand{Token: spectatorToken, Fields: []string{"players"}}, &players)
+		if member := players.Teams[0].Members[0]; !member.PointsHidden {
+			t.Errorf("Points should be hidden from delayed spectators, got %+v", member)
+		}
+	})
+}
+
+func TestServer_Presence(t *testing.T) {
+
+	server := newTestServer()
+	server.game.AfkTimeout = time.Minute
+	token := joinTestPlayer(t, server, "j")
+	player := server.game.GetPlayerByUsername("j")
+
+	// Any command marks the Player as active again
+	player.LastActive = time.Now().Add(-time.Hour)
+	var response string
+	server.Points(ClientCommand{Token: token, Fields: []string{"points"}}, &PointsReply{})
+	if server.game.Presence(player) != game.ONLINE {
+		t.Error("Player should be online after sending a command")
+	}
+
+	var players PlayersReply
+	server.Players(ClientCommand{Token: token, Fields: []string{"players"}}, &players)
+	if !strings.Contains(players.Render(), "online") {
+		t.Error("Player list should show who is online")
+	}
+
+	server.Logout(ClientCommand{Token: token, Fields: []string{"logout"}}, &response)
+	if server.game.Presence(player) != game.DEPARTED {
+		t.Error("Player should be departed after logging out")
+	}
+}
+
+func TestServer_TypedReplies(t *testing.T) {
+
+	server := newTestServer()
+	tokenA := joinTestPlayer(t, server, "a")
+	tokenB := joinTestPlayer(t, server, "b")
+	a := server.game.GetPlayerByUsername("a")
+	b := server.game.GetPlayerByUsername("b")
+
+	command := func(token, input string) ClientCommand {
+		return ClientCommand{Token: token, Fields: strings.Fields(input)}
+	}
+
+	a.Team.DeploymentPoints = 10
+	b.Team.DeploymentPoints = 10
+
+	var deployed DeployReply
+	if err := server.Deploy(command(tokenA, "deploy A0 2 V"), &deployed); err != nil ||
+		deployed.Size != 2 || deployed.DeploymentPoints != a.Team.DeploymentPoints {
+		t.Errorf("Deploy should describe the new Ship, got %+v %v", deployed, err)
+	}
+	server.Deploy(command(tokenB, "deploy A0 2 V"), &DeployReply{})
+
+	var board MapReply
+	server.Map(command(tokenA, "map"), &board)
+	ships := 0
+	for _, column := range board.Cells {
+		for _, cell := range column {
+			if cell == game.CELL_SHIP {
+				ships++
+			}
+		}
+	}
+	if board.Team != a.Team.Name || int(board.Size) != len(board.Cells) || ships != 2 {
+		t.Errorf("Map should show the Team's Ship, got %+v", board)
+	}
+
+	var shot ShotReply
+	server.Target(command(tokenA, fmt.Sprintf("target %v A0", b.Team.Id)), &shot)
+	if shot.Result != game.HIT || shot.Streak != 1 || shot.Target != "A0" {
+		t.Errorf("Shot should report a hit, got %+v", shot)
+	}
+	if shot.Render() != "Shot confirmed HIT!\n1 hit streak\n" {
+		t.Errorf("Shot should render as before, got %q", shot.Render())
+	}
+
+	var radar MapReply
+	server.Radar(command(tokenA, fmt.Sprintf("radar %v", b.Team.Id)), &radar)
+	if radar.Target != b.Team.Name || radar.Cells[0][0] != game.CELL_HIT {
+		t.Errorf("Radar should show the hit, got %+v", radar)
+	}
+
+	var teams TeamsReply
+	server.Teams(command(tokenA, "teams"), &teams)
+	for _, team := range teams.Teams {
+		if team.Yours != (team.Id == a.Team.Id) || team.Ships != 1 {
+			t.Errorf("Teams should mark the Player's own Team and count Ships, got %+v", team)
+		}
+	}
+
+	var players PlayersReply
+	server.Players(command(tokenA, "players"), &players)
+	for _, roster := range players.Teams {
+		for _, member := range roster.Members {
+			if member.PointsHidden != (member.Username == "b") {
+				t.Errorf("Points should only be hidden for other Teams, got %+v", member)
+			}
+		}
+	}
+
+	if _, typed := NewReply("Server.Map").(*MapReply); !typed {
+		t.Error("NewReply should return a MapReply for Server.Map")
+	}
+	if _, text := NewReply("Server.Chat").(*string); !text {
+		t.Error("NewReply should return a string for Server.Chat")
+	}
+}
+
+func TestServer_Switch(t *testing.T) {
+
+	server := newTestServer()
+	token := joinTestPlayer(t, server, "j")
+	player := server.game.GetPlayerByUsername("j")
+	player.Points = 5
+
+	// Points can't go below 0, so the switch only costs what the Player had
+	var response string
+	other := server.game.Teams[1]
+	if player.Team == other {
+		other = server.game.Teams[0]
+	}
+	err := server.Switch(ClientCommand{Token: token, Fields: []string{"switch", strconv.Itoa(other.Id)}}, &response)
+	if err != nil || !strings.Contains(response, "cost you 5 points, you now have 0") {
+		t.Errorf("Switch should report the points actually taken, got %q %v", response, err)
+	}
+}
+
+func TestServer_Chat(t *testing.T) {
+
+	server := newTestServer()
+
+	// Players alternate between the two Teams as they join
+	aToken := joinTestPlayer(t, server, "a")
+	bToken := joinTestPlayer(t, server, "b")
+	cToken := joinTestPlayer(t, server, "c")
+
+	var details JoinDetails
+	server.JoinGame(LoginCredentials{Username: "s", Password: "s", Spectator: true, ProtocolVersion: PROTOCOL_VERSION}, &details)
+	sToken := details.Token
+
+	var response string
+	send := func(token, input string) error {
+		return server.Chat(ClientCommand{Token: token, Fields: strings.Fields(input)}, &response)
+	}
+	poll := func(token string) string {
+		var unread string
+		if err := server.ChatPoll(ClientCommand{Token: token}, &unread); err != nil {
+			t.Error("Error Thrown: ", err)
+		}
+		return unread
+	}
+
+	if err := send(aToken, "$ hello everyone"); err != nil {
+		t.Error("Error Thrown: ", err)
+	}
+	send(aToken, "# team only")
+	send(aToken, "@b just for b")
+	send(bToken, "@ a reply to a")
+
+	if err := send(aToken, "@nobody hi"); err == nil {
+		t.Error("Messaging an unknown player should return error")
+	}
+	if err := send(sToken, "$ spoilers"); err != ErrSpectator {
+		t.Error("Spectators should not be able to chat")
+	}
+
+	b := poll(bToken)
+	if !strings.Contains(b, "hello everyone") || strings.Contains(b, "team only") || !strings.Contains(b, "just for b") {
+		t.Errorf("b should get all chat and their private message, got %q", b)
+	}
+
+	c := poll(cToken)
+	if !strings.Contains(c, "hello everyone") || !strings.Contains(c, "team only") || strings.Contains(c, "just for b") {
+		t.Errorf("c should get all chat and team chat, got %q", c)
+	}
+
+	a := poll(aToken)
+	if a != "[@b -> a] reply to a\n" {
+		t.Errorf("a should only get b's reply, got %q", a)
+	}
+
+	s := poll(sToken)
+	if !strings.Contains(s, "hello everyone") || strings.Contains(s, "team only") {
+		t.Errorf("Spectators should only read all chat, got %q", s)
+	}
+
+	if poll(bToken) != "" {
+		t.Error("Messages should only be delivered once")
+	}
+
+	// Polling in the background doesn't count as activity
+	player := server.game.GetPlayerByUsername("c")
+	player.LastActive = time.Now().Add(-time.Hour)
+	poll(cToken)
+	if time.Since(player.LastActive) < time.Hour {
+		t.Error("Polling for chat should not mark a Player as active")
+	}
+}
+
+func TestServer_ChatModeration(t *testing.T) {
+
+	server := newTestServer()
+	aToken := joinTestPlayer(t, server, "a")
+	bToken := joinTestPlayer(t, server, "b")
+
+	var response string
+	send := func(token, input string) error {
+		return server.Chat(ClientCommand{Token: token, Fields: strings.Fields(input)}, &response)
+	}
+
+	// Rate limit
+	for i := 0; i < CHAT_RATE_LIMIT; i++ {
+		if err := send(aToken, fmt.Sprintf("$ message %v", i)); err != nil {
+			t.Error("Error Thrown: ", err)
+		}
+	}
+	if err := send(aToken, "$ one too many"); err == nil {
+		t.Error("Sending past the rate limit should return error")
+	}
+
+	// History
+	server.History(ClientCommand{Token: bToken, Fields: []string{"history", "all", "2"}}, &response)
+	if strings.Count(response, "\n") != 2 || !strings.Contains(response, "message 4") {
+		t.Errorf("History should show the last 2 messages, got %q", response)
+	}
+
+	// Mute hides messages, ignore blocks private messages too
+	server.Mute(ClientCommand{Token: bToken, Fields: []string{"mute", "a"}}, &response)
+	server.History(ClientCommand{Token: bToken, Fields: []string{"history"}}, &response)
+	if response != "No messages\n" {
+		t.Errorf("Muted player's messages should be hidden, got %q", response)
+	}
+
+	server.Ignore(ClientCommand{Token: bToken, Fields: []string{"ignore", "a"}}, &response)
+	server.chatRoom.sent = make(map[*game.Player][]time.Time)
+	if err := send(aToken, "@b hello"); err == nil {
+		t.Error("Messaging a player who is ignoring you should return error")
+	}
+
+	// Admin silence
+	var adminResponse string
+	server.Admin(ClientCommand{Token: bToken, Fields: []string{"admin", "adminpass"}}, &adminResponse)
+	if err := server.Silence(ClientCommand{Token: bToken, Fields: []string{"silence", "a", "1m"}}, &adminResponse); err != nil {
+		t.Error("Error Thrown: ", err)
+	}
+	if err := send(aToken, "$ let me talk"); err == nil {
+		t.Error("Silenced player should not be able to chat")
+	}
+
+	server.Silence(ClientCommand{Token: bToken, Fields: []string{"silence", "a", "0"}}, &adminResponse)
+	if err := send(aToken, "$ thanks"); err != nil {
+		t.Error("Lifting a silence should let the player chat again: ", err)
+	}
+}
+
+func TestChatRoom_PrivateChannels(t *testing.T) {
+
+	// Usernames with | in them mustn't let two pairs of Players share a channel
+	if PrivateChannel("a|b", "c") == PrivateChannel("a", "b|c") {
+		t.Error("Different pairs of Players should have different private channels")
+	}
+	if PrivateChannel("a", "b") != PrivateChannel("b", "a") {
+		t.Error("Private channel should be the same whichever way round the Players are given")
+	}
+
+	room := NewChatRoom()
+	team := &game.Team{Id: 1}
+	c := &game.Player{Username: "c", Team: team}
+	seen := room.Join(c)
+
+	// Even on a shared channel only the sender and recipient read a message
+	room.Post(PrivateChannel("a", "b|c"), "a", "b|c", "not for c")
+	if unread := room.Unread(c, &seen); len(unread) != 0 {
+		t.Errorf("Player should not read private messages between others, got %v", unread)
+	}
+	if history := room.History(c, PrivateChannel("a", "b|c"), 10); len(history) != 0 {
+		t.Errorf("Player should not see the history of private messages between others, got %v", history)
+	}
+}
+
+func TestChatRoom_Log(t *testing.T) {
+
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("warships-chat-%v.log", time.Now().UnixNano()))
+	defer os.Remove(path)
+
+	room := NewChatRoom()
+	if err := room.OpenLog(path); err != nil {
+		t.Fatal("Error Thrown: ", err)
+	}
+
+	room.Post(CHAT_ALL, "a", "", "logged message")
+	room.log.Close()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil || !strings.Contains(string(data), "[all] [ALL] a: logged message") {
+		t.Errorf("Chat log should contain the message, got %q", data)
+	}
+}
+
+func TestServer_Announcements(t *testing.T) {
+
+	server := newTestServer()
+	adminToken := joinTestPlayer(t, server, "admin")
+	playerToken := joinTestPlayer(t, server, "j")
+
+	var response string
+	if err := server.Announce(ClientCommand{Token: adminToken, Fields: []string{"announce", "hello"}}, &response); err != ErrForbidden {
+		t.Error("Announcing without admin privileges should return ErrForbidden")
+	}
+
+	// Announcements come back with the next command's response
+	server.Rename(ClientCommand{Token: playerToken, Fields: []string{"rename", "Armada"}}, &response)
+	if !strings.Contains(response, "is now known as Armada") {
+		t.Errorf("Renaming a team should be announced, got %q", response)
+	}
+
+	server.Admin(ClientCommand{Token: adminToken, Fields: []string{"admin", "adminpass"}}, &response)
+	server.Announce(ClientCommand{Token: adminToken, Fields: []string{"announce", "server", "restarting", "soon"}}, &response)
+
+	// ...or reach the Player in the background without them sending a command
+	var feed string
+	server.ChatPoll(ClientCommand{Token: playerToken}, &feed)
+	if feed != "[ANNOUNCEMENT] [ADMIN] server restarting soon\n" {
+		t.Errorf("Feed should include the admin announcement, got %q", feed)
+	}
+}
+
+func TestServer_Subscribe(t *testing.T) {
+
+	server := newTestServer()
+	shooterToken := joinTestPlayer(t, server, "a")
+	targetToken := joinTestPlayer(t, server, "b")
+
+	shooter := server.game.GetPlayerByUsername("a")
+	target := server.game.GetPlayerByUsername("b")
+	shooter.Team.NewShip(2, game.VERTICAL, game.Coordinate{X: 0, Y: 0})
+	target.Team.NewShip(2, game.VERTICAL, game.Coordinate{X: 0, Y: 0})
+
+	// Subscribe waits until there is something to send
+	feed := make(chan string)
+	go func() {
+		var response string
+		server.Subscribe(ClientCommand{Token: targetToken}, &response)
+		feed <- response
+	}()
+
+	select {
+	case response := <-feed:
+		t.Fatalf("Subscribe should wait for an Event, got %q", response)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	server.Target(ClientCommand{Token: shooterToken, Fields: []string{"target", strconv.Itoa(target.Team.Id), "A0"}}, &ShotReply{})
+
+	expected := fmt.Sprintf("[SHOT] a of %v fired at A0: HIT\n", shooter.Team.Name)
+	select {
+	case response := <-feed:
+		if response != expected {
+			t.Errorf("Subscribe should return the shot as soon as it is fired, got %q", response)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Subscribe was not woken by the shot")
+	}
+
+	// Anything already waiting is returned straight away
+	var response string
+	server.Chat(ClientCommand{Token: shooterToken, Fields: []string{"$", "hi"}}, &response)
+	server.Subscribe(ClientCommand{Token: targetToken}, &response)
+	if response != "[ALL] a: hi\n" {
+		t.Errorf("Subscribe should return waiting chat messages, got %q", response)
+	}
+
+	// A Player connected twice is sent everything on both Clients
+	secondToken := joinTestPlayer(t, server, "b")
+	server.Target(ClientCommand{Token: shooterToken, Fields: []string{"target", strconv.Itoa(target.Team.Id), "B5"}}, &ShotReply{})
+	server.Chat(ClientCommand{Token: shooterToken, Fields: []string{"$", "both"}}, &response)
+
+	var first, second string
+	server.Subscribe(ClientCommand{Token: targetToken}, &first)
+	server.Subscribe(ClientCommand{Token: secondToken}, &second)
+	if first != second || !strings.Contains(first, "fired at B5") || !strings.Contains(first, "[ALL] a: both") {
+		t.Errorf("Both sessions should be sent every Event and message, got %q and %q", first, second)
+	}
+
+	if err := server.Subscribe(ClientCommand{Token: "invalid"}, &response); err == nil {
+		t.Error("Subscribe should need a valid session")
+	}
+}
+
+func TestServer_Handshake(t *testing.T) {
+
+	server := newTestServer()
+
+	// Clients from before the handshake send no version
+	var details JoinDetails
+	err := server.JoinGame(LoginCredentials{Username: "j", Password: "j"}, &details)
+	if _, outdated := err.(*IncompatibleVersion); !outdated || !strings.Contains(err.Error(), "client is out of date") {
+		t.Errorf("Client without a protocol version should be told to update, got %v", err)
+	}
+	if server.game.GetPlayerByUsername("j") != nil {
+		t.Error("Out of date Client should not join the Game")
+	}
+
+	login := LoginCredentials{Username: "j", Password: "j", ProtocolVersion: PROTOCOL_VERSION, Commands: ClientCommands()}
+	if err := server.JoinGame(login, &details); err != nil {
+		t.Fatal("Current Client should be able to join: ", err)
+	}
+
+	if details.ProtocolVersion != PROTOCOL_VERSION {
+		t.Errorf("Server should send its protocol version, got %v", details.ProtocolVersion)
+	}
+
+	missing := missingCommands(login.Commands, details.Commands)
+	if len(missing) != 1 || missing[0] != "Server.Sweep" {
+		t.Errorf("Server should list every command it supports, missing %v", missing)
+	}
+}
+
+func TestServer_SlowJoin(t *testing.T) {
+
+	server := newTestServer()
+	token := joinTestPlayer(t, server, "a")
+	joinTestPlayer(t, server, "slow")
+
+	// A stored hash with many more iterations than usual makes checking it take a while
+	server.game.GetPlayerByUsername("slow").PasswordHash = "pbkdf2-sha256$1000000$c2FsdA$AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+
+	var err error
+	joined := make(chan struct{})
+	go func() {
+		var details JoinDetails
+		err = server.JoinGame(LoginCredentials{Username: "slow", Password: "wrong", ProtocolVersion: PROTOCOL_VERSION}, &details)
+		close(joined)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	server.Map(ClientCommand{Token: token, Fields: []string{"map"}}, &MapReply{})
+	server.Target(ClientCommand{Token: token, Fields: []string{"target", "2", "A0"}}, &ShotReply{})
+
+	select {
+	case <-joined:
+		t.Error("Commands should not wait for a join's password check")
+	default:
+	}
+
+	<-joined
+	if err != game.ErrIncorrectPassword {
+		t.Errorf("Slow join with the wrong password should be turned away, got %v", err)
+	}
+}
+
+func TestParsePort(t *testing.T) {
+
+	if port, err := ParsePort(""); err != nil || port != RPC_PORT {
+		t.Error("Blank port should use RPC_PORT")
+	}
+
+	if port, err := ParsePort("4000"); err != nil || port != 4000 {
+		t.Error("ParsePort should return the given port")
+	}
+
+	for _, invalid := range []string{"0", "65536", "port"} {
+		if _, err := ParsePort(invalid); err == nil {
+			t.Errorf("ParsePort(%v) should return error", invalid)
+		}
+	}
+}
+
+// TestServer_Concurrency runs commands from many Players at once alongside the Game tick.
+// CI runs the tests with -race, which fails this test if any state is shared unguarded
+func TestServer_Concurrency(t *testing.T) {
+
+	server := newTestServer()
+	server.game.StartDeployPts = 1000
+	for _, team := range server.game.Teams {
+		team.DeploymentPoints = 1000
+		team.NewShip(2, game.HORIZONTAL, game.Coordinate{X: 0, Y: 0})
+	}
+	server.game.AddBot(game.HARD, nil)
+
+	const PLAYERS = 8
+	tokens := make([]string, PLAYERS)
+	for i := range tokens {
+		tokens[i] = joinTestPlayer(t, server, fmt.Sprintf("p%v", i))
+	}
+
+	var wg sync.WaitGroup
+	for i, token := range tokens {
+		wg.Add(1)
+		go func(i int, token string) {
+			defer wg.Done()
+
+			var response string
+			command := func(input string) ClientCommand {
+				return ClientCommand{Token: token, Fields: strings.Fields(input)}
+			}
+
+			for round := 0; round < 10; round++ {
+				target := game.Coordinate{X: uint8(round), Y: uint8(i)}.ToTarget()
+				server.Target(command(fmt.Sprintf("target %v %v%v", 1+i%2, target.X, target.Y)), &ShotReply{})
+				server.Target(command(fmt.Sprintf("target %v %v%v", 2-i%2, target.X, target.Y)), &ShotReply{})
+				server.Deploy(command(fmt.Sprintf("deploy %v%v 2 V", target.X, round+2)), &DeployReply{})
+				server.Switch(command(fmt.Sprintf("switch %v", 1+round%2)), &response)
+				server.Chat(command("$ hello"), &response)
+				server.ChatPoll(command(""), &response)
+				server.Map(command("map"), &MapReply{})
+				server.Radar(command("radar 1"), &MapReply{})
+				server.Players(command("players"), &PlayersReply{})
+			}
+		}(i, token)
+	}
+
+	// New Players and the Game tick at the same time as the commands above
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 4; i++ {
+			var details JoinDetails
+			server.JoinGame(LoginCredentials{Username: fmt.Sprintf("late%v", i), Password: "late", ProtocolVersion: PROTOCOL_VERSION}, &details)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			server.tick()
+		}
+	}()
+
+	wg.Wait()
+
+	// Every Player should be on exactly one Team, and the counts should add up
+	seen := make(map[*game.Player]bool)
+	for _, team := range server.game.Teams {
+		if team.NumPlayers != len(team.Players) {
+			t.Errorf("%v has %v players but counts %v", team.Name, len(team.Players), team.NumPlayers)
+		}
+		for _, player := range team.Players {
+			if seen[player] || player.Team != team {
+				t.Errorf("%v is on more than one team", player.Username)
+			}
+			seen[player] = true
+		}
+	}
+}
+
+// maskedFrame builds a single masked Client frame by hand
+func maskedFrame(fin bool, opcode byte, payload string) []byte {
+
+	header := opcode
+	if fin {
+		header |= 0x80
+	}
+
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	frame := append([]byte{header, 0x80 | byte(len(payload))}, mask...)
+	for i := range payload {
+		frame = append(frame, payload[i]^mask[i%4])
+	}
+
+	return frame
+}
+
+func TestWebSocket_Frames(t *testing.T) {
+
+	// The example handshake from RFC 6455
+	if accept := WebSocketAccept("dGhlIHNhbXBsZSBub25jZQ=="); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Wrong Sec-WebSocket-Accept value %q", accept)
+	}
+
+	clientConn, serverConn := net.Pipe()
+	client := NewWebSocket(clientConn, bufio.NewReader(clientConn), true)
+	server := NewWebSocket(serverConn, bufio.NewReader(serverConn), false)
+
+	// Short and 16 bit lengths
+	medium := strings.Repeat("x", 1000)
+	go func() {
+		client.WriteMessage([]byte("short"))
+		client.WriteMessage([]byte(medium))
+	}()
+
+	if message, err := server.ReadMessage(); err != nil || string(message) != "short" {
+		t.Errorf("Short message not read back: %q %v", message, err)
+	}
+	if message, err := server.ReadMessage(); err != nil || string(message) != medium {
+		t.Errorf("Medium message not read back: %v", err)
+	}
+
+	// A fragmented message with a ping in the middle, which gets a pong
+	go func() {
+		clientConn.Write(maskedFrame(false, OPCODE_TEXT, "hel"))
+		clientConn.Write(maskedFrame(true, OPCODE_PING, "ping"))
+		clientConn.Write(maskedFrame(true, OPCODE_CONTINUATION, "lo"))
+	}()
+	pong := make(chan string)
+	go func() {
+		_, opcode, payload, _ := client.readFrame()
+		if opcode != OPCODE_PONG {
+			pong <- ""
+		}
+		pong <- string(payload)
+	}()
+
+	if message, err := server.ReadMessage(); err != nil || string(message) != "hello" {
+		t.Errorf("Fragmented message not put back together: %q %v", message, err)
+	}
+	if payload := <-pong; payload != "ping" {
+		t.Errorf("Ping should be answered with a pong carrying the same payload, got %q", payload)
+	}
+
+	// Server frames are not masked
+	go server.WriteMessage([]byte("reply"))
+	if message, err := client.ReadMessage(); err != nil || string(message) != "reply" {
+		t.Errorf("Server message not read back: %q %v", message, err)
+	}
+
+	// Closing ends the connection
+	go clientConn.Write(maskedFrame(true, OPCODE_CLOSE, ""))
+	if _, err := server.ReadMessage(); err != io.EOF {
+		t.Errorf("Close frame should end the connection, got %v", err)
+	}
+
+	// Clients must mask their frames
+	go clientConn.Write([]byte{0x80 | OPCODE_TEXT, 2, 'h', 'i'})
+	if _, err := server.ReadMessage(); err == nil {
+		t.Error("Unmasked frames from the Client should be refused")
+	}
+}
+
+// dialTestWebSocket opens a WebSocket to a test HTTP server, doing the handshake by hand
+func dialTestWebSocket(t *testing.T, address string) *WebSocket {
+
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal("Error connecting: ", err)
+	}
+
+	fmt.Fprintf(conn, "GET %v HTTP/1.1\r\nHost: %v\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n", WEBSOCKET_PATH, address)
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal("Error reading handshake: ", err)
+	}
+	if response.StatusCode != http.StatusSwitchingProtocols ||
+		response.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Handshake refused: %v %v", response.Status, response.Header)
+	}
+
+	return NewWebSocket(conn, reader, true)
+}
+
+func TestServer_WebSocketGateway(t *testing.T) {
+
+	server := newTestServer()
+	httpServer := httptest.NewServer(websocketHandler{server})
+	defer httpServer.Close()
+
+	// Plain HTTP requests are turned away
+	if response, err := http.Get(httpServer.URL); err != nil || response.StatusCode != http.StatusBadRequest {
+		t.Error("Requests that aren't WebSocket handshakes should be refused")
+	}
+
+	ws := dialTestWebSocket(t, httpServer.Listener.Addr().String())
+	defer ws.Close()
+
+	request := func(message string) GatewayMessage {
+		if err := ws.WriteMessage([]byte(message)); err != nil {
+			t.Fatal("Error writing: ", err)
+		}
+		data, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal("Error reading: ", err)
+		}
+		var reply GatewayMessage
+		if err := json.Unmarshal(data, &reply); err != nil {
+			t.Fatal("Reply is not JSON: ", err)
+		}
+		return reply
+	}
+
+	if reply := request(`{"id": 1, "fields": ["teams"]}`); reply.Type != GATEWAY_ERROR || reply.Id != 1 ||
+		reply.Text != ErrUnauthorized.Error() {
+		t.Errorf("Commands before logging in should be refused, got %+v", reply)
+	}
+
+	reply := request(`{"id": 2, "login": {"username": "web", "password": "web"}}`)
+	if reply.Type != GATEWAY_JOINED || reply.Join == nil || reply.Join.Token == "" {
+		t.Fatalf("Logging in should return the join details, got %+v", reply)
+	}
+
+	if reply := request(`{"id": 3, "fields": ["teams"]}`); reply.Type != GATEWAY_RESPONSE || reply.Id != 3 ||
+		!strings.Contains(reply.Text, server.game.Teams[0].Name) {
+		t.Errorf("Commands should return their response, got %+v", reply)
+	}
+
+	if reply := request(`{"id": 4, "fields": ["fly"]}`); reply.Type != GATEWAY_ERROR || reply.Text != "command 'fly' not found" {
+		t.Errorf("Unknown commands should be refused, got %+v", reply)
+	}
+
+	if reply := request(`{"id": 5, "login": {"username": "other", "password": "other"}}`); reply.Type != GATEWAY_ERROR ||
+		server.game.GetPlayerByUsername("other") != nil {
+		t.Errorf("Logging in twice on one connection should be refused, got %+v", reply)
+	}
+
+	// Chat from a Go client is pushed to the browser
+	token := joinTestPlayer(t, server, "go")
+	var response string
+	server.Chat(ClientCommand{Token: token, Fields: []string{"$", "hello", "browser"}}, &response)
+
+	data, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatal("Error reading: ", err)
+	}
+	var event GatewayMessage
+	json.Unmarshal(data, &event)
+	if event.Type != GATEWAY_EVENT || event.Text != "[ALL] go: hello browser" {
+		t.Errorf("Chat should be pushed as an event, got %+v", event)
+	}
+}
+
+func TestServer_API(t *testing.T) {
+
+	server := newTestServer()
+	for _, team := range server.game.Teams {
+		team.DeploymentPoints = 10
+	}
+	httpServer := httptest.NewServer(apiHandler{server})
+	defer httpServer.Close()
+
+	call := func(method, path, token, body string) (int, apiResponse, string) {
+		req, _ := http.NewRequest(method, httpServer.URL+path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		response, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal("Error calling API: ", err)
+		}
+		defer response.Body.Close()
+
+		data, _ := ioutil.ReadAll(response.Body)
+		var decoded apiResponse
+		json.Unmarshal(data, &decoded)
+		return response.StatusCode, decoded, string(data)
+	}
+
+	status, _, body := call("POST", "/api/join", "", `{"username": "api", "password": "api"}`)
+	var details JoinDetails
+	if err := json.Unmarshal([]byte(body), &details); status != http.StatusOK || err != nil || details.Token == "" {
+		t.Fatalf("Joining should return the join details, got %v %v", status, body)
+	}
+	token := details.Token
+
+	if status, _, _ := call("POST", "/api/join", "", `{"username": "api", "password": "wrong"}`); status != http.StatusUnauthorized {
+		t.Errorf("Wrong password should be 401, got %v", status)
+	}
+
+	if status, response, _ := call("GET", "/api/teams", "", ""); status != http.StatusUnauthorized ||
+		response.Error != ErrUnauthorized.Error() {
+		t.Errorf("Commands without a token should be 401 with an error body, got %v %+v", status, response)
+	}
+
+	status, _, body = call("GET", "/api/teams", token, "")
+	var teams struct{ Reply TeamsReply }
+	if err := json.Unmarshal([]byte(body), &teams); status != http.StatusOK || err != nil ||
+		len(teams.Reply.Teams) != 2 || teams.Reply.Teams[0].Name != server.game.Teams[0].Name {
+		t.Errorf("Teams should list the teams, got %v %v", status, body)
+	}
+
+	if status, response, _ := call("POST", "/api/deploy", token, `{"target": "A0", "size": 2, "orientation": "V"}`); status != http.StatusOK {
+		t.Errorf("Deploy should place a ship, got %v %+v", status, response)
+	}
+
+	player := server.game.GetPlayerByUsername("api")
+	if len(player.Team.Ships) != 1 || player.Team.Ships[0].Size != 2 {
+		t.Error("Deploy through the API should place the ship on the Player's Team")
+	}
+
+	var enemy *game.Team
+	for _, team := range server.game.Teams {
+		if team != player.Team {
+			enemy = team
+		}
+	}
+	body = fmt.Sprintf(`{"team": %v, "target": "B3"}`, enemy.Id)
+	status, _, body = call("POST", "/api/target", token, body)
+	var shot struct{ Reply ShotReply }
+	if err := json.Unmarshal([]byte(body), &shot); status != http.StatusOK || err != nil || shot.Reply.Result != game.MISS {
+		t.Errorf("Target should fire a shot, got %v %v", status, body)
+	}
+
+	if status, response, _ := call("POST", "/api/rename", token, `{"name": "42"}`); status != http.StatusBadRequest || response.Error == "" {
+		t.Errorf("Commands the game refuses should be 400 with an error body, got %v %+v", status, response)
+	}
+
+	if status, _, _ := call("POST", "/api/target", token, `["B3"]`); status != http.StatusBadRequest {
+		t.Errorf("Bodies that aren't JSON objects should be 400, got %v", status)
+	}
+
+	req, _ := http.NewRequest("GET", httpServer.URL+"/api/target", nil)
+	if response, err := http.DefaultClient.Do(req); err != nil || response.StatusCode != http.StatusMethodNotAllowed ||
+		response.Header.Get("Allow") != "POST" {
+		t.Error("Wrong method should be 405 with the method allowed")
+	}
+
+	if status, _, _ := call("GET", "/api/fly", token, ""); status != http.StatusNotFound {
+		t.Errorf("Unknown commands should be 404, got %v", status)
+	}
+}
+
+func TestServer_Discovery(t *testing.T) {
+
+	server := newTestServer()
+	server.game.Name = "lan party"
+	server.game.Port = 4000
+	joinTestPlayer(t, server, "j")
+	server.game.Password = "pass"
+
+	listener, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	server.game.Lock()
+	announcement := server.announcement()
+	server.game.Unlock()
+
+	// The Server announces itself over and over, other traffic on the port is ignored
+	addresses := []*net.UDPAddr{listener.LocalAddr().(*net.UDPAddr)}
+	sendAnnouncement(conn, announcement, addresses)
+	conn.WriteToUDP([]byte(`{"game": "something else"}`), addresses[0])
+	sendAnnouncement(conn, announcement, addresses)
+
+	servers := listenForServers(listener, 200 * time.Millisecond)
+	if len(servers) != 1 {
+		t.Fatalf("Each Server should be listed once, got %+v", servers)
+	}
+
+	found := servers[0]
+	if found.Address != "127.0.0.1:4000" || found.Name != "lan party" || found.Players != 1 ||
+		found.MaxPlayers != 32 || found.BoardSize != 16 || !found.Password {
+		t.Errorf("Announcement should describe the Game, got %+v", found)
+	}
+
+	if found.String() != "lan party (127.0.0.1:4000) - 1/32 players, 16x16 board, password required" {
+		t.Errorf("Announcement should describe the Game in a line, got %q", found.String())
+	}
+
+	if broadcast := broadcastAddresses(DISCOVERY_PORT); !broadcast[0].IP.Equal(net.IPv4bcast) {
+		t.Error("Announcements should always go to the limited broadcast address")
+	}
+}
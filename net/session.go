@@ -0,0 +1,274 @@
+package net
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	game "github.com/jason-meredith/warships/game"
+)
+
+/*********************************************************
+ *														 *
+ *                   	  Warships						 *
+ *					   Jason Meredith					 *
+ *														 *
+ *	DATE:		October 18, 2026						 *
+ *	FILE: 		session.go								 *
+ *	PURPOSE:	Session tokens handed out when a Player	 *
+ *				joins. Every command a Client sends must *
+ *				carry a live token, the Server checks it *
+ *				here before running the command itself.	 *
+ *				 										 *
+ *														 *
+ *********************************************************/
+
+// ErrUnauthorized is returned for any command sent without a valid session token
+var ErrUnauthorized = errors.New("unauthorized: session is invalid or has expired, please rejoin the game")
+
+// ErrForbidden is returned for admin commands sent from a session without admin privileges
+var ErrForbidden = errors.New("forbidden: admin privileges required, run 'admin <password>' first")
+
+// DEFAULT_SESSION_TIMEOUT is how long a session lasts without activity if the Game
+// doesn't set its own SessionTimeout
+const DEFAULT_SESSION_TIMEOUT = 30 * time.Minute
+
+// TOKEN_SIZE is the number of random bytes in a session token
+const TOKEN_SIZE = 24
+
+// Session ties a token given to a Client to the Player it logged in as
+type Session struct {
+	Token	string
+	Player	*game.Player
+	Expires	time.Time
+
+	// True once the session has been given the admin password
+	Admin	bool
+
+	// How far through the Game's Events and the chat this session's Client has been
+	// sent, so a Player connected twice gets everything on both. Only used with the
+	// Game lock held
+	EventsSeen	int
+	ChatSeen	int
+}
+
+// SessionStore holds every live Session on the Server. RPCs are served concurrently
+// so all access goes through the mutex
+type SessionStore struct {
+	mutex		sync.Mutex
+	timeout		time.Duration
+	sessions	map[string]*Session
+}
+
+// NewSessionStore creates an empty SessionStore whose sessions expire after timeout
+// without activity
+func NewSessionStore(timeout time.Duration) *SessionStore {
+	if timeout <= 0 {
+		timeout = DEFAULT_SESSION_TIMEOUT
+	}
+
+	return &SessionStore{
+		timeout:  timeout,
+		sessions: make(map[string]*Session),
+	}
+}
+
+// Issue creates a new Session for a Player and returns it
+func (store *SessionStore) Issue(player *game.Player) (*Session, error) {
+
+	buffer := make([]byte, TOKEN_SIZE)
+	if _, err := rand.Read(buffer); err != nil {
+		return nil, errors.New("unable to generate session token")
+	}
+
+	// New sessions pick up where the Player's furthest along Client left off
+	session := &Session{
+		Token:      hex.EncodeToString(buffer),
+		Player:     player,
+		Expires:    time.Now().Add(store.timeout),
+		EventsSeen: player.EventsSeen,
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.prune()
+	store.sessions[session.Token] = session
+
+	return session, nil
+}
+
+// Validate looks up the Session for a token. If the Session is still live its expiry
+// is pushed back, otherwise ErrUnauthorized is returned
+func (store *SessionStore) Validate(token string) (*Session, error) {
+	return store.lookup(token, true)
+}
+
+// lookup finds the live Session for a token, renewing it if renew is set
+func (store *SessionStore) lookup(token string, renew bool) (*Session, error) {
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	session, exists := store.sessions[token]
+	if !exists {
+		return nil, ErrUnauthorized
+	}
+
+	if time.Now().After(session.Expires) {
+		delete(store.sessions, token)
+		return nil, ErrUnauthorized
+	}
+
+	// Renew on activity
+	if renew {
+		session.Expires = time.Now().Add(store.timeout)
+	}
+
+	return session, nil
+}
+
+// Promote gives a Session admin privileges
+func (store *SessionStore) Promote(token string) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if session, exists := store.sessions[token]; exists {
+		session.Admin = true
+	}
+}
+
+// IsAdmin returns true if the Session for a token has admin privileges
+func (store *SessionStore) IsAdmin(token string) bool {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	session, exists := store.sessions[token]
+	return exists && session.Admin
+}
+
+// Revoke ends a single Session
+func (store *SessionStore) Revoke(token string) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.sessions, token)
+}
+
+// RevokePlayer ends every Session belonging to a Player
+func (store *SessionStore) RevokePlayer(player *game.Player) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for token, session := range store.sessions {
+		if session.Player == player {
+			delete(store.sessions, token)
+		}
+	}
+}
+
+// prune removes expired sessions, the mutex must already be held
+func (store *SessionStore) prune() {
+	now := time.Now()
+
+	for token, session := range store.sessions {
+		if now.After(session.Expires) {
+			delete(store.sessions, token)
+		}
+	}
+}
+
+// ErrSpectator is returned when a spectator tries a command that acts on the Game
+var ErrSpectator = errors.New("spectators cannot do that, rejoin as a player to take part")
+
+// Access is integer used to represent the Access enum options. Represents who
+// is allowed to run a command
+type Access uint8
+
+// Access levels, from Players on a Team to everyone logged in including spectators,
+// to sessions with admin privileges. ACCESS_POLL is for requests the Client makes on its
+// own in the background, which anyone logged in may make but don't count as activity
+const (
+	ACCESS_PLAYERS Access = iota
+	ACCESS_EVERYONE
+	ACCESS_ADMIN
+	ACCESS_POLL
+)
+
+// commandHandler is a Server command that runs on behalf of an authenticated Player
+type commandHandler func(player *game.Player, args ClientCommand, response *string) error
+
+// run is the single point every Client command passes through. It checks the session
+// token on the ClientCommand and only hands off to the command handler once the token
+// has been matched to a Player on a Team. Any unseen announcements are added to the response
+func (t *Server) run(args ClientCommand, response *string, handler commandHandler) error {
+	return t.dispatch(args, response, handler, ACCESS_PLAYERS)
+}
+
+// runOpen is run for commands that spectators may use as well
+func (t *Server) runOpen(args ClientCommand, response *string, handler commandHandler) error {
+	return t.dispatch(args, response, handler, ACCESS_EVERYONE)
+}
+
+// runAdmin is run for commands that also need a session with admin privileges
+func (t *Server) runAdmin(args ClientCommand, response *string, handler commandHandler) error {
+	return t.dispatch(args, response, handler, ACCESS_ADMIN)
+}
+
+// runPoll is run for background requests, which don't keep the session or Player active
+func (t *Server) runPoll(args ClientCommand, response *string, handler commandHandler) error {
+	return t.dispatch(args, response, handler, ACCESS_POLL)
+}
+
+// dispatch authenticates a ClientCommand and runs its handler, see run
+func (t *Server) dispatch(args ClientCommand, response *string, handler commandHandler, access Access) error {
+
+	session, err := t.sessions.lookup(args.Token, access != ACCESS_POLL)
+	if err != nil {
+		timeStamp()
+		fmt.Printf("Unauthorized command rejected\n")
+		fmt.Printf("\t-Fields: %v\n", args.Fields)
+		return err
+	}
+
+	// Wake any Clients waiting on Subscribe once the command is done
+	if access != ACCESS_POLL {
+		defer t.notifier.Notify()
+	}
+
+	// Commands run one at a time, see game.Lock
+	t.game.Lock()
+	defer t.game.Unlock()
+
+	if access == ACCESS_PLAYERS && session.Player.Spectator {
+		return ErrSpectator
+	}
+
+	// Admin is set by Promote, so it's read under the SessionStore's lock
+	if access == ACCESS_ADMIN && !t.sessions.IsAdmin(args.Token) {
+		timeStamp()
+		fmt.Printf("Forbidden admin command rejected\n")
+		fmt.Printf("\t-Player: %v (%v)\n", session.Player.Username, session.Player.Id)
+		fmt.Printf("\t-Fields: %v\n", args.Fields)
+		return ErrForbidden
+	}
+
+	if access != ACCESS_POLL {
+		session.Player.Touch()
+	}
+
+	if err := handler(session.Player, args, response); err != nil {
+		return err
+	}
+
+	// Pass along anything announced since the Player's last command
+	announcements := ""
+	for _, announcement := range t.game.UnseenAnnouncements(session.Player) {
+		announcements += fmt.Sprintf("[ANNOUNCEMENT] %v\n", announcement.Message)
+	}
+	*response = announcements + *response
+
+	return nil
+}
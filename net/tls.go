@@ -0,0 +1,236 @@
+package net
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/rpc"
+	"os"
+	"time"
+)
+
+/*********************************************************
+ *														 *
+ *                   	  Warships						 *
+ *					   Jason Meredith					 *
+ *														 *
+ *	DATE:		October 18, 2026						 *
+ *	FILE: 		tls.go									 *
+ *	PURPOSE:	Optional TLS between Clients and the	 *
+ *				Server. The Server makes and keeps its	 *
+ *				own self-signed certificate, Clients	 *
+ *				pin the certificate a Server shows the	 *
+ *				first time they connect to it.			 *
+ *				 										 *
+ *														 *
+ *********************************************************/
+
+const (
+	// DEFAULT_CERT_FILE and DEFAULT_KEY_FILE are where the Server keeps its certificate
+	DEFAULT_CERT_FILE = "warships-cert.pem"
+	DEFAULT_KEY_FILE  = "warships-key.pem"
+
+	// DEFAULT_KNOWN_SERVERS_FILE is where Clients keep the certificates they have pinned
+	DEFAULT_KNOWN_SERVERS_FILE = "warships-known-servers.json"
+
+	// CERT_VALIDITY is how long a generated certificate lasts
+	CERT_VALIDITY = 10 * 365 * 24 * time.Hour
+)
+
+// LoadOrCreateCertificate loads the Server's certificate and key. If neither file exists a
+// self-signed certificate is generated and saved to them, returning created as true
+func LoadOrCreateCertificate(certFile, keyFile string) (cert tls.Certificate, created bool, err error) {
+
+	_, certErr := os.Stat(certFile)
+	_, keyErr := os.Stat(keyFile)
+
+	if os.IsNotExist(certErr) && os.IsNotExist(keyErr) {
+		if err = createCertificate(certFile, keyFile); err != nil {
+			return
+		}
+		created = true
+	}
+
+	cert, err = tls.LoadX509KeyPair(certFile, keyFile)
+	return
+}
+
+// createCertificate generates a self-signed certificate and saves it and its key
+func createCertificate(certFile, keyFile string) error {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "Warships Server"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(CERT_VALIDITY),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := ioutil.WriteFile(certFile, certPem, 0644); err != nil {
+		return err
+	}
+
+	// Anyone with the key can pretend to be the Server
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return ioutil.WriteFile(keyFile, keyPem, 0600)
+}
+
+// CertificateFingerprint returns the SHA-256 fingerprint of a DER encoded certificate
+func CertificateFingerprint(der []byte) string {
+	hash := sha256.Sum256(der)
+	return hex.EncodeToString(hash[:])
+}
+
+// KnownServers holds the certificate fingerprint of every Server a Client has connected
+// to over TLS, by address, saved to Path
+type KnownServers struct {
+	Path			string
+	Fingerprints	map[string]string
+}
+
+// LoadKnownServers loads the pinned certificates from a file, starting with none if the
+// file doesn't exist yet
+func LoadKnownServers(path string) (*KnownServers, error) {
+
+	known := &KnownServers{Path: path, Fingerprints: make(map[string]string)}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return known, nil
+	}
+	if err != nil {
+		return known, err
+	}
+
+	if err := json.Unmarshal(data, &known.Fingerprints); err != nil {
+		return known, errors.New("known servers file is corrupt: " + path)
+	}
+
+	if known.Fingerprints == nil {
+		known.Fingerprints = make(map[string]string)
+	}
+
+	return known, nil
+}
+
+// Save writes the pinned certificates to the KnownServers file
+func (known *KnownServers) Save() error {
+
+	data, err := json.MarshalIndent(known.Fingerprints, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(known.Path, data, 0600)
+}
+
+// Check compares the certificate a Server showed with the one pinned for its address.
+// Servers that haven't been seen before pass, see Pin
+func (known *KnownServers) Check(address, fingerprint string) error {
+
+	pinned, exists := known.Fingerprints[address]
+	if exists && pinned != fingerprint {
+		return fmt.Errorf("the certificate of %v has changed since it was first trusted, someone may be "+
+			"pretending to be the server. If the server really changed its certificate remove it from %v",
+			address, known.Path)
+	}
+
+	return nil
+}
+
+// Pin trusts the certificate of a Server seen for the first time and saves it for next
+// time. Only call it once the handshake is done and the Server has proven it holds the key
+func (known *KnownServers) Pin(address, fingerprint string) error {
+
+	if _, exists := known.Fingerprints[address]; exists {
+		return nil
+	}
+
+	fmt.Printf("Trusting %v on first use, certificate fingerprint %v\n", address, fingerprint)
+	known.Fingerprints[address] = fingerprint
+	return known.Save()
+}
+
+// TLSConfig returns the TLS settings for connecting to a Server. Self-signed certificates
+// can't be verified the usual way, so the pinned certificate is checked instead. The
+// check runs before the Server has proven it holds the key, so nothing is pinned here
+func (known *KnownServers) TLSConfig(address string) *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("server sent no certificate")
+			}
+			return known.Check(address, CertificateFingerprint(rawCerts[0]))
+		},
+	}
+}
+
+// dialRPC connects to the RPC handler of the Server at address the way rpc.DialHTTP does,
+// over TLS if the KnownServers to check its certificate against are given
+func dialRPC(address string, known *KnownServers) (*rpc.Client, error) {
+
+	if known == nil {
+		return rpc.DialHTTP("tcp", address)
+	}
+
+	conn, err := tls.Dial("tcp", address, known.TLSConfig(address))
+	if err != nil {
+		return nil, err
+	}
+
+	// The handshake is done, so the Server holds the key to the certificate it showed
+	if err := known.Pin(address, CertificateFingerprint(conn.ConnectionState().PeerCertificates[0].Raw)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	io.WriteString(conn, "CONNECT "+rpc.DefaultRPCPath+" HTTP/1.0\n\n")
+
+	response, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: "CONNECT"})
+	if err == nil && response.Status == "200 Connected to Go RPC" {
+		return rpc.NewClient(conn), nil
+	}
+	if err == nil {
+		err = errors.New("unexpected HTTP response: " + response.Status)
+	}
+
+	conn.Close()
+	return nil, err
+}
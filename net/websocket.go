@@ -0,0 +1,301 @@
+package net
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+/*********************************************************
+ *														 *
+ *                   	  Warships						 *
+ *					   Jason Meredith					 *
+ *														 *
+ *	DATE:		October 18, 2026						 *
+ *	FILE: 		websocket.go							 *
+ *	PURPOSE:	The WebSocket protocol (RFC 6455): the	 *
+ *				opening handshake and reading and		 *
+ *				writing frames, so browsers can talk	 *
+ *				to the Server without net/rpc.			 *
+ *				 										 *
+ *														 *
+ *********************************************************/
+
+const (
+	// WEBSOCKET_GUID is added to the Client's key to prove the Server speaks WebSocket
+	WEBSOCKET_GUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	// WEBSOCKET_MAX_MESSAGE is the largest message accepted, in bytes
+	WEBSOCKET_MAX_MESSAGE = 64 * 1024
+)
+
+// Frame opcodes, what the payload of a frame is
+const (
+	OPCODE_CONTINUATION byte = 0x0
+	OPCODE_TEXT         byte = 0x1
+	OPCODE_BINARY       byte = 0x2
+	OPCODE_CLOSE        byte = 0x8
+	OPCODE_PING         byte = 0x9
+	OPCODE_PONG         byte = 0xA
+)
+
+// ErrNotWebSocket is returned when an HTTP request isn't asking to open a WebSocket
+var ErrNotWebSocket = errors.New("not a websocket handshake")
+
+// ErrMessageTooLarge is returned when a message is longer than WEBSOCKET_MAX_MESSAGE
+var ErrMessageTooLarge = errors.New("websocket message too large")
+
+// WebSocket is one end of an open WebSocket connection. Messages can be written from any
+// goroutine, but only one goroutine may read
+type WebSocket struct {
+	conn	net.Conn
+	reader	*bufio.Reader
+
+	// Frames sent by the Client end must be masked, frames sent by the Server must not
+	client	bool
+
+	writeMutex	sync.Mutex
+}
+
+// NewWebSocket wraps a connection that has already been through the opening handshake.
+// client is true for the end that opened the connection
+func NewWebSocket(conn net.Conn, reader *bufio.Reader, client bool) *WebSocket {
+	return &WebSocket{conn: conn, reader: reader, client: client}
+}
+
+// WebSocketAccept returns the Sec-WebSocket-Accept value for a Client's Sec-WebSocket-Key
+func WebSocketAccept(key string) string {
+	hash := sha1.Sum([]byte(key + WEBSOCKET_GUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// UpgradeWebSocket completes the opening handshake for an HTTP request asking to open a
+// WebSocket and takes over its connection
+func UpgradeWebSocket(w http.ResponseWriter, req *http.Request) (*WebSocket, error) {
+
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if req.Method != "GET" || key == "" ||
+		!headerContains(req.Header, "Connection", "upgrade") ||
+		!headerContains(req.Header, "Upgrade", "websocket") {
+		http.Error(w, "400 websocket handshake expected", http.StatusBadRequest)
+		return nil, ErrNotWebSocket
+	}
+
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "426 websocket version 13 required", http.StatusUpgradeRequired)
+		return nil, ErrNotWebSocket
+	}
+
+	conn, buffer, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = io.WriteString(conn, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: "+WebSocketAccept(key)+"\r\n\r\n")
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// Anything the Client sent straight after the handshake is already in the buffer
+	return NewWebSocket(conn, buffer.Reader, false), nil
+}
+
+// headerContains returns true if one of the comma separated values of an HTTP header is
+// token, ignoring case
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadMessage returns the next text or binary message, putting fragmented messages back
+// together. Pings are answered along the way. Returns io.EOF once the other end closes
+// the connection, the caller should then Close its end
+func (ws *WebSocket) ReadMessage() ([]byte, error) {
+
+	var message []byte
+	started := false
+
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case OPCODE_PING:
+			if err := ws.writeFrame(OPCODE_PONG, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case OPCODE_PONG:
+			continue
+		case OPCODE_CLOSE:
+			// Close answers with a close frame of its own
+			return nil, io.EOF
+		case OPCODE_TEXT, OPCODE_BINARY:
+			if started {
+				return nil, errors.New("websocket message started before the last one finished")
+			}
+			started = true
+		case OPCODE_CONTINUATION:
+			if !started {
+				return nil, errors.New("websocket continuation frame with no message to continue")
+			}
+		default:
+			return nil, errors.New("unknown websocket opcode")
+		}
+
+		if len(message)+len(payload) > WEBSOCKET_MAX_MESSAGE {
+			return nil, ErrMessageTooLarge
+		}
+		message = append(message, payload...)
+
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+// readFrame reads a single frame and unmasks its payload
+func (ws *WebSocket) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+
+	var header [2]byte
+	if _, err = io.ReadFull(ws.reader, header[:]); err != nil {
+		return
+	}
+
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	if header[0]&0x70 != 0 {
+		err = errors.New("websocket frame uses an extension that was not agreed")
+		return
+	}
+
+	// Control frames are short and never fragmented
+	if opcode >= OPCODE_CLOSE && (!fin || length > 125) {
+		err = errors.New("invalid websocket control frame")
+		return
+	}
+
+	// Only frames from the Client are masked
+	if masked == ws.client {
+		err = errors.New("websocket frame masking is the wrong way round")
+		return
+	}
+
+	// Longer lengths follow in the next 2 or 8 bytes
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err = io.ReadFull(ws.reader, extended[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err = io.ReadFull(ws.reader, extended[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+
+	if length > WEBSOCKET_MAX_MESSAGE {
+		err = ErrMessageTooLarge
+		return
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(ws.reader, mask[:]); err != nil {
+			return
+		}
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(ws.reader, payload); err != nil {
+		return
+	}
+
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return
+}
+
+// WriteMessage sends a text message in a single frame
+func (ws *WebSocket) WriteMessage(message []byte) error {
+	return ws.writeFrame(OPCODE_TEXT, message)
+}
+
+// writeFrame sends a single frame, masking it if this is the Client end
+func (ws *WebSocket) writeFrame(opcode byte, payload []byte) error {
+
+	frame := []byte{0x80 | opcode}
+
+	maskBit := byte(0)
+	if ws.client {
+		maskBit = 0x80
+	}
+
+	switch length := len(payload); {
+	case length <= 125:
+		frame = append(frame, maskBit|byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, maskBit|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(length))
+	default:
+		frame = append(frame, maskBit|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(length))
+	}
+
+	if ws.client {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		frame = append(frame, mask[:]...)
+
+		masked := make([]byte, len(payload))
+		for i := range payload {
+			masked[i] = payload[i] ^ mask[i%4]
+		}
+		payload = masked
+	}
+
+	ws.writeMutex.Lock()
+	defer ws.writeMutex.Unlock()
+
+	_, err := ws.conn.Write(append(frame, payload...))
+	return err
+}
+
+// Close sends a close frame and closes the connection
+func (ws *WebSocket) Close() error {
+	ws.writeFrame(OPCODE_CLOSE, nil)
+	return ws.conn.Close()
+}